@@ -0,0 +1,380 @@
+// http.FileSystem over zip and tar(.gz) archives, indexed once when opened
+package engine
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveFS serves the files of a zip or tar archive, it can be passed to
+// StaticFS or any other http.FileSystem consumer. Files carry the modtime of
+// the archive entry, support Seek (Range requests) and implement ETag.
+type ArchiveFS struct {
+	entries map[string]*archiveEntry
+	closer  io.Closer
+}
+
+var _ http.FileSystem = (*ArchiveFS)(nil)
+
+// OpenArchive opens a .zip, .tar, .tar.gz or .tgz file, call Close when done
+//
+//	docs, err := engine.OpenArchive("docs.zip")
+//	r.StaticFS("/docs", docs)
+func OpenArchive(name string) (*ArchiveFS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	var archive *ArchiveFS
+	switch lower := strings.ToLower(name); {
+	case strings.HasSuffix(lower, ".zip"):
+		var stat os.FileInfo
+		if stat, err = f.Stat(); err == nil {
+			archive, err = NewZipFS(f, stat.Size())
+		}
+	case strings.HasSuffix(lower, ".tar"), strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		// tar entries are read into memory, the file isn't needed afterwards
+		archive, err = NewTarFS(f)
+		f.Close()
+		return archive, err
+	default:
+		err = fmt.Errorf("archive: unknown format of %s", name)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	archive.closer = f
+	return archive, nil
+}
+
+// NewZipFS indexes the zip archive of size bytes read from r, r must stay
+// readable as long as the ArchiveFS is used. Stored entries are read in place,
+// compressed ones are inflated while they are read: memory use stays at the
+// decompressor window whatever the entry size, but a Range request far into a
+// large compressed entry inflates everything before its offset. Store big
+// files that are served with Range (videos...) without compression.
+func NewZipFS(r io.ReaderAt, size int64) (*ArchiveFS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	archive := newArchiveFS()
+	for _, file := range zr.File {
+		file := file
+		if file.FileInfo().IsDir() {
+			archive.addDir(file.Name, file.Modified)
+			continue
+		}
+		entry := &archiveEntry{
+			size:    int64(file.UncompressedSize64),
+			modTime: file.Modified,
+			etag:    fmt.Sprintf(`"%08x-%x"`, file.CRC32, file.UncompressedSize64),
+		}
+		if file.Method == zip.Store {
+			offset, err := file.DataOffset()
+			if err != nil {
+				return nil, err
+			}
+			entry.open = func() (io.ReadSeeker, error) {
+				return io.NewSectionReader(r, offset, entry.size), nil
+			}
+		} else {
+			entry.open = func() (io.ReadSeeker, error) {
+				return &zipEntryReader{file: file, size: entry.size}, nil
+			}
+		}
+		archive.addFile(file.Name, entry)
+	}
+	archive.sortDirs()
+	return archive, nil
+}
+
+// zipEntryReader inflates a compressed zip entry on demand, Seek only moves
+// the offset: reading forward skips the data in between, reading backwards
+// starts the decompression over
+type zipEntryReader struct {
+	file *zip.File
+	size int64
+	rc   io.ReadCloser
+	// pos is the position of rc in the entry, offset the one of the next Read
+	pos    int64
+	offset int64
+}
+
+func (r *zipEntryReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.rc == nil || r.offset < r.pos {
+		r.Close()
+		rc, err := r.file.Open()
+		if err != nil {
+			return 0, err
+		}
+		r.rc, r.pos = rc, 0
+	}
+	if r.offset > r.pos {
+		n, err := io.CopyN(io.Discard, r.rc, r.offset-r.pos)
+		r.pos += n
+		if errors.Is(err, io.EOF) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.rc.Read(p)
+	r.pos += int64(n)
+	r.offset = r.pos
+	return n, err
+}
+
+func (r *zipEntryReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("zip: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("zip: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *zipEntryReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
+
+// NewTarFS indexes the tar archive read from r, gzip compression is detected.
+// The content of the files is kept in memory.
+func NewTarFS(r io.Reader) (*ArchiveFS, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	tr := tar.NewReader(r)
+	archive := newArchiveFS()
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			archive.sortDirs()
+			return archive, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			archive.addDir(header.Name, header.ModTime)
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			archive.addFile(header.Name, &archiveEntry{
+				size:    int64(len(data)),
+				modTime: header.ModTime,
+				etag:    fmt.Sprintf(`"%08x-%x"`, crc32.ChecksumIEEE(data), len(data)),
+				open: func() (io.ReadSeeker, error) {
+					return bytes.NewReader(data), nil
+				},
+			})
+		}
+		// links and devices are not served
+	}
+}
+
+func newArchiveFS() *ArchiveFS {
+	return &ArchiveFS{
+		entries: map[string]*archiveEntry{
+			"/": {name: "/", dir: true},
+		},
+	}
+}
+
+// addDir returns the directory name, creating it and its parents if needed
+func (archive *ArchiveFS) addDir(name string, modTime time.Time) *archiveEntry {
+	name = path.Clean("/" + name)
+	if entry, ok := archive.entries[name]; ok {
+		if entry.modTime.IsZero() {
+			entry.modTime = modTime
+		}
+		return entry
+	}
+	entry := &archiveEntry{name: path.Base(name), modTime: modTime, dir: true}
+	archive.entries[name] = entry
+	parent := archive.addDir(path.Dir(name), time.Time{})
+	parent.children = append(parent.children, entry)
+	return entry
+}
+
+func (archive *ArchiveFS) addFile(name string, entry *archiveEntry) {
+	name = path.Clean("/" + name)
+	if _, ok := archive.entries[name]; ok {
+		// the last entry wins, like when extracting the archive
+		archive.removeChild(name)
+	}
+	entry.name = path.Base(name)
+	archive.entries[name] = entry
+	parent := archive.addDir(path.Dir(name), time.Time{})
+	parent.children = append(parent.children, entry)
+}
+
+func (archive *ArchiveFS) removeChild(name string) {
+	parent := archive.entries[path.Dir(name)]
+	for i, child := range parent.children {
+		if child == archive.entries[name] {
+			parent.children = append(parent.children[:i], parent.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// sortDirs sorts the children of every directory by name for Readdir
+func (archive *ArchiveFS) sortDirs() {
+	for _, entry := range archive.entries {
+		children := entry.children
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].name < children[j].name
+		})
+	}
+}
+
+// Open implements http.FileSystem
+func (archive *ArchiveFS) Open(name string) (http.File, error) {
+	entry, ok := archive.entries[path.Clean("/"+name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if entry.dir {
+		return &archiveFile{entry: entry}, nil
+	}
+	rs, err := entry.open()
+	if err != nil {
+		return nil, err
+	}
+	return &archiveFile{ReadSeeker: rs, entry: entry}, nil
+}
+
+// Close closes the archive file opened by OpenArchive
+func (archive *ArchiveFS) Close() error {
+	if archive.closer == nil {
+		return nil
+	}
+	return archive.closer.Close()
+}
+
+// archiveEntry is a file or directory of the archive, it is its own os.FileInfo
+type archiveEntry struct {
+	name     string
+	size     int64
+	modTime  time.Time
+	etag     string
+	dir      bool
+	children []*archiveEntry
+	open     func() (io.ReadSeeker, error)
+}
+
+func (e *archiveEntry) Name() string       { return e.name }
+func (e *archiveEntry) Size() int64        { return e.size }
+func (e *archiveEntry) ModTime() time.Time { return e.modTime }
+func (e *archiveEntry) IsDir() bool        { return e.dir }
+func (e *archiveEntry) Sys() interface{}   { return nil }
+
+func (e *archiveEntry) Mode() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// archiveFile is an open entry, directories have no ReadSeeker
+type archiveFile struct {
+	io.ReadSeeker
+	entry *archiveEntry
+	// read position in entry.children for Readdir
+	pos int
+}
+
+func (f *archiveFile) Read(p []byte) (int, error) {
+	if f.entry.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.entry.name, Err: errors.New("is a directory")}
+	}
+	return f.ReadSeeker.Read(p)
+}
+
+func (f *archiveFile) Seek(offset int64, whence int) (int64, error) {
+	if f.entry.dir {
+		return 0, &fs.PathError{Op: "seek", Path: f.entry.name, Err: errors.New("is a directory")}
+	}
+	return f.ReadSeeker.Seek(offset, whence)
+}
+
+func (f *archiveFile) Close() error {
+	if closer, ok := f.ReadSeeker.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (f *archiveFile) Stat() (os.FileInfo, error) {
+	return f.entry, nil
+}
+
+// ETag is picked up by the static handler, it is derived from the CRC32 and
+// size of the entry
+func (f *archiveFile) ETag() string {
+	return f.entry.etag
+}
+
+// Readdir follows os.File.Readdir
+func (f *archiveFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.entry.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.entry.name, Err: errors.New("not a directory")}
+	}
+	rest := f.entry.children[f.pos:]
+	if count > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && count < len(rest) {
+		rest = rest[:count]
+	}
+	f.pos += len(rest)
+	infos := make([]os.FileInfo, len(rest))
+	for i, child := range rest {
+		infos[i] = child
+	}
+	return infos, nil
+}
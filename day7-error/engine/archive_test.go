@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	archiveModTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	archiveFiles   = map[string]string{
+		"index.html":      "<h1>docs</h1>",
+		"guide/intro.txt": strings.Repeat("introduction ", 100),
+	}
+)
+
+func writeZip(t *testing.T, name string) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for file, data := range archiveFiles {
+		method := zip.Deflate
+		if strings.HasSuffix(file, ".html") {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file, Method: method, Modified: archiveModTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	zw.Close()
+	if err := os.WriteFile(name, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTar(t *testing.T, name string, compress bool) {
+	var buf bytes.Buffer
+	var tw *tar.Writer
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(zw)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	tw.WriteHeader(&tar.Header{Name: "guide/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: archiveModTime})
+	for file, data := range archiveFiles {
+		tw.WriteHeader(&tar.Header{Name: file, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data)), ModTime: archiveModTime})
+		tw.Write([]byte(data))
+	}
+	tw.WriteHeader(&tar.Header{Name: "latest", Typeflag: tar.TypeSymlink, Linkname: "index.html"})
+	tw.Close()
+	if zw != nil {
+		zw.Close()
+	}
+	if err := os.WriteFile(name, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveFS(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "docs.zip"))
+	writeTar(t, filepath.Join(dir, "docs.tar"), false)
+	writeTar(t, filepath.Join(dir, "docs.tar.gz"), true)
+
+	for _, name := range []string{"docs.zip", "docs.tar", "docs.tar.gz"} {
+		archive, err := OpenArchive(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		defer archive.Close()
+		r := New()
+		r.StaticFS("/docs", ListDirectory(archive))
+
+		w := serveWith(r, "GET", "/docs/", nil)
+		if w.Code != http.StatusOK || w.Body.String() != "<h1>docs</h1>" || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Fatalf("%s: unexpected index %d %q %v", name, w.Code, w.Body.String(), w.Header())
+		}
+		intro := archiveFiles["guide/intro.txt"]
+		w = serveWith(r, "GET", "/docs/guide/intro.txt", nil)
+		etag := w.Header().Get("ETag")
+		if w.Body.String() != intro || etag == "" || w.Header().Get("Last-Modified") != archiveModTime.Format(http.TimeFormat) {
+			t.Fatalf("%s: unexpected file %v", name, w.Header())
+		}
+		w = serveWith(r, "GET", "/docs/guide/intro.txt", map[string]string{"Range": "bytes=13-24"})
+		if w.Code != http.StatusPartialContent || w.Body.String() != intro[13:25] {
+			t.Fatalf("%s: Range should be served, got %d %q", name, w.Code, w.Body.String())
+		}
+		w = serveWith(r, "GET", "/docs/guide/intro.txt", map[string]string{"If-None-Match": etag})
+		if w.Code != http.StatusNotModified {
+			t.Fatalf("%s: matching ETag should give 304, got %d", name, w.Code)
+		}
+		w = serveWith(r, "GET", "/docs/guide/", nil)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "intro.txt") {
+			t.Fatalf("%s: directory should be listed, got %d %q", name, w.Code, w.Body.String())
+		}
+		if w = serveWith(r, "GET", "/docs/latest", nil); w.Code != http.StatusNotFound {
+			t.Fatalf("%s: links should not be served, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestArchiveFSETagFollowsContent(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "docs.zip"))
+	writeTar(t, filepath.Join(dir, "docs.tgz"), true)
+	zipFS, err := OpenArchive(filepath.Join(dir, "docs.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zipFS.Close()
+	tarFS, err := OpenArchive(filepath.Join(dir, "docs.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, _ := zipFS.Open("/index.html")
+	tf, _ := tarFS.Open("/index.html")
+	if zf.(*archiveFile).ETag() != tf.(*archiveFile).ETag() {
+		t.Fatal("the same content should get the same ETag in every format")
+	}
+
+	if _, err := OpenArchive(filepath.Join(dir, "docs.rar")); err == nil {
+		t.Fatal("unknown archive should fail")
+	}
+}
+
+func TestZipEntryReaderSeek(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "docs.zip"))
+	archive, err := OpenArchive(filepath.Join(dir, "docs.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	f, err := archive.Open("/guide/intro.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, ok := f.(*archiveFile).ReadSeeker.(*zipEntryReader); !ok {
+		t.Fatal("deflated entries should be inflated on demand")
+	}
+
+	intro := archiveFiles["guide/intro.txt"]
+	buf := make([]byte, 12)
+	// forward, then backwards which starts over
+	for _, offset := range []int64{500, 13, 0} {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(f, buf); err != nil || string(buf) != intro[offset:offset+12] {
+			t.Fatalf("read at %d: %q %v", offset, buf, err)
+		}
+	}
+	if size, _ := f.Seek(0, io.SeekEnd); size != int64(len(intro)) {
+		t.Fatalf("SeekEnd should give the size, got %d", size)
+	}
+	if n, err := f.Read(buf); n != 0 || err != io.EOF {
+		t.Fatalf("read at the end should be EOF, got %d %v", n, err)
+	}
+}
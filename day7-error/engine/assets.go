@@ -0,0 +1,180 @@
+// fingerprinted assets: cache-busted URLs served with immutable caching
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// immutableCacheControl lets browsers keep a fingerprinted asset for a year
+// without revalidating, its URL changes with its content anyway
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// AssetOptions configures StaticAssets
+type AssetOptions struct {
+	// Manifest is the path in fs of a JSON manifest as written by bundlers,
+	// {"css/app.css": "css/app.3f9a1c.css"}, the fingerprinted files must exist in fs.
+	// Without manifest every file of fs is hashed at startup and served under
+	// its fingerprinted name as well.
+	Manifest string
+}
+
+// assetManifest maps asset names to fingerprinted names and back
+type assetManifest struct {
+	prefix string
+	// css/geektutu.css -> css/geektutu.3f9a1c.css
+	names map[string]string
+	// css/geektutu.3f9a1c.css -> css/geektutu.css, empty in manifest mode
+	// where the fingerprinted files exist
+	files map[string]string
+	// fingerprinted names, served with immutableCacheControl
+	immutable map[string]bool
+}
+
+// StaticAssets works like StaticFS and serves every file under a fingerprinted
+// name as well, e.g. /assets/css/geektutu.3f9a1c.css, with an immutable
+// Cache-Control. Templates get the URL of an asset with the asset function:
+//
+//	<link rel="stylesheet" href="{{asset "css/geektutu.css"}}">
+//
+// An engine has one asset route, a second call replaces the first for templates.
+func (group *RouterGroup) StaticAssets(relativePath string, fs http.FileSystem, opts AssetOptions) error {
+	checkStaticPath(relativePath)
+	m := &assetManifest{
+		prefix:    path.Join(group.prefix, relativePath),
+		names:     make(map[string]string),
+		files:     make(map[string]string),
+		immutable: make(map[string]bool),
+	}
+	var err error
+	if opts.Manifest != "" {
+		err = m.load(fs, opts.Manifest)
+	} else {
+		err = m.hash(fs, "/")
+	}
+	if err != nil {
+		return fmt.Errorf("assets: %w", err)
+	}
+
+	static := group.createStaticHandler(relativePath, assetFS{fs, m})
+	handler := func(c *Context) {
+		if m.immutable[c.Param("filepath")] {
+			c.SetHeader("Cache-Control", immutableCacheControl)
+		}
+		static(c)
+	}
+	// /*filepath doesn't match the root directory itself, see StaticFS
+	group.Get(relativePath, handler)
+	group.Get(path.Join(relativePath, "/*filepath"), handler)
+	group.engine.assets = m
+	return nil
+}
+
+// load reads a bundler manifest
+func (m *assetManifest) load(fs http.FileSystem, name string) error {
+	f, err := fs.Open(path.Join("/", name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var names map[string]string
+	if err := json.NewDecoder(f).Decode(&names); err != nil {
+		return fmt.Errorf("manifest %s: %w", name, err)
+	}
+	for name, fingerprinted := range names {
+		name, fingerprinted = strings.TrimPrefix(name, "/"), strings.TrimPrefix(fingerprinted, "/")
+		m.names[name] = fingerprinted
+		m.immutable[fingerprinted] = true
+	}
+	return nil
+}
+
+// hash walks dir and fingerprints every file with its content,
+// precompressed siblings follow the file they belong to
+func (m *assetManifest) hash(fs http.FileSystem, dir string) error {
+	d, err := fs.Open(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := d.Readdir(-1)
+	d.Close()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if err := m.hash(fs, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasSuffix(name, ".br") || strings.HasSuffix(name, ".gz") {
+			continue
+		}
+		sum, err := hashFile(fs, name)
+		if err != nil {
+			return err
+		}
+		name = strings.TrimPrefix(name, "/")
+		ext := path.Ext(name)
+		fingerprinted := strings.TrimSuffix(name, ext) + "." + sum + ext
+		m.names[name] = fingerprinted
+		m.files[fingerprinted] = name
+		m.immutable[fingerprinted] = true
+	}
+	return nil
+}
+
+// hashFile returns the first 8 hex digits of the sha256 of the file
+func hashFile(fs http.FileSystem, name string) (string, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)[:4]), nil
+}
+
+// url returns the fingerprinted URL of name
+func (m *assetManifest) url(name string) (string, error) {
+	fingerprinted, ok := m.names[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return "", fmt.Errorf("asset %q not found", name)
+	}
+	return path.Join(m.prefix, fingerprinted), nil
+}
+
+// assetFS opens the file behind a fingerprinted name, precompressed siblings included
+type assetFS struct {
+	http.FileSystem
+	m *assetManifest
+}
+
+func (fs assetFS) Open(name string) (http.File, error) {
+	for _, ext := range []string{"", ".br", ".gz"} {
+		if file, ok := fs.m.files[strings.TrimPrefix(strings.TrimSuffix(name, ext), "/")]; ok {
+			return fs.FileSystem.Open("/" + file + ext)
+		}
+	}
+	return fs.FileSystem.Open(name)
+}
+
+// assetFunc is the asset template function, it fails the rendering for an
+// unknown asset rather than emitting a broken link
+func (engine *Engine) assetFunc(name string) (string, error) {
+	if engine.assets == nil {
+		return "", fmt.Errorf("asset %q: no StaticAssets route", name)
+	}
+	return engine.assets.url(name)
+}
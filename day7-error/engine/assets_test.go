@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticAssetsHashed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"css/geektutu.css":    {Data: []byte("p{color:red}")},
+		"css/geektutu.css.gz": {Data: []byte("gzipped")},
+		"js/app.js":           {Data: []byte("alert(1)")},
+	}
+	r := New()
+	if err := r.StaticAssets("/assets", http.FS(fsys), AssetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	url, err := r.assetFunc("css/geektutu.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, _ := hashFile(http.FS(fsys), "css/geektutu.css")
+	if url != "/assets/css/geektutu."+sum+".css" {
+		t.Fatalf("unexpected asset url %s", url)
+	}
+
+	w := serveWith(r, "GET", url, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "p{color:red}" || w.Header().Get("Cache-Control") != immutableCacheControl {
+		t.Fatalf("fingerprinted asset should be served immutable, got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	w = serveWith(r, "GET", url, map[string]string{"Accept-Encoding": "gzip"})
+	if w.Body.String() != "gzipped" || w.Header().Get("Content-Type") != "text/css; charset=utf-8" {
+		t.Fatalf("precompressed sibling should follow the fingerprint, got %q %v", w.Body.String(), w.Header())
+	}
+	w = serveWith(r, "GET", "/assets/css/geektutu.css", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "" {
+		t.Fatalf("plain name should still be served without immutable caching, got %d %v", w.Code, w.Header())
+	}
+	// the root behaves like StaticFS, redirected to its slash form
+	w = serveWith(r, "GET", "/assets", nil)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "assets/" {
+		t.Fatalf("asset root should be redirected, got %d %v", w.Code, w.Header())
+	}
+	if _, err := r.assetFunc("css/missing.css"); err == nil {
+		t.Fatal("unknown asset should fail")
+	}
+}
+
+func TestStaticAssetsManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"manifest.json":     {Data: []byte(`{"js/app.js": "js/app.3f9a1c.js"}`)},
+		"js/app.3f9a1c.js":  {Data: []byte("alert(1)")},
+		"js/app.js.LICENSE": {Data: []byte("MIT")},
+	}
+	r := New()
+	api := r.Group("/static")
+	if err := api.StaticAssets("/v1", http.FS(fsys), AssetOptions{Manifest: "manifest.json"}); err != nil {
+		t.Fatal(err)
+	}
+	if url, _ := r.assetFunc("js/app.js"); url != "/static/v1/js/app.3f9a1c.js" {
+		t.Fatalf("unexpected asset url %s", url)
+	}
+	w := serveWith(r, "GET", "/static/v1/js/app.3f9a1c.js", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != immutableCacheControl {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+
+	if err := r.StaticAssets("/other", http.FS(fsys), AssetOptions{Manifest: "missing.json"}); err == nil {
+		t.Fatal("missing manifest should fail")
+	}
+}
+
+func TestAssetTemplateFunc(t *testing.T) {
+	dir := t.TempDir()
+	r := New()
+	if err := r.StaticAssets("/assets", http.FS(fstest.MapFS{"css/site.css": {Data: []byte("body{}")}}), AssetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	writeTemplate(t, dir, "css.tmpl", `<link rel="stylesheet" href="{{asset "css/site.css"}}">`)
+	r.LoadHTMLGlob(dir + "/*")
+	r.Get("/", func(c *Context) {
+		c.HTML(http.StatusOK, "css.tmpl", nil)
+	})
+	w := serveWith(r, "GET", "/", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="/assets/css/site.`) {
+		t.Fatalf("unexpected page %d %q", w.Code, w.Body.String())
+	}
+}
+
+func writeTemplate(t *testing.T, dir string, name string, text string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,157 @@
+// client IP resolution honouring proxy headers only from trusted proxies
+package engine
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// defaultRemoteIPHeaders is what most proxies append to, see SetRemoteIPHeaders
+var defaultRemoteIPHeaders = []string{"X-Forwarded-For"}
+
+// SetTrustedProxies sets the proxies allowed to report the client IP through
+// the headers of SetRemoteIPHeaders. Entries are CIDRs ("10.0.0.0/8") or
+// single IPs ("127.0.0.1"). Without trusted proxies the headers are ignored,
+// which is the only safe choice when clients reach the server directly.
+func (engine *Engine) SetTrustedProxies(proxies []string) error {
+	cidrs := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, cidr, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	engine.trustedCIDRs = cidrs
+	return nil
+}
+
+// SetRemoteIPHeaders sets the headers ClientIP reads behind a trusted proxy,
+// X-Forwarded-For by default. List only the headers your proxies set: the others
+// are passed through from the client, who could pick its address with them.
+// Headers are tried in order, supported are Forwarded, X-Forwarded-For and
+// single value headers like X-Real-IP.
+//
+//	r.SetRemoteIPHeaders("X-Real-IP") // nginx with proxy_set_header X-Real-IP $remote_addr
+func (engine *Engine) SetRemoteIPHeaders(headers ...string) {
+	engine.remoteIPHeaders = headers
+}
+
+func (engine *Engine) isTrustedProxy(ip net.IP) bool {
+	for _, cidr := range engine.trustedCIDRs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteIP returns the IP of the direct peer, i.e. the host part of RemoteAddr
+func (c *Context) RemoteIP() string {
+	ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Req.RemoteAddr))
+	if err != nil {
+		return ""
+	}
+	return ip
+}
+
+// ClientIP returns the IP of the client. When the peer is a trusted proxy the
+// headers of SetRemoteIPHeaders are checked, the chain of hops is walked from the
+// right and the first untrusted hop wins, so a client can't spoof its address by
+// prepending values.
+func (c *Context) ClientIP() string {
+	remote := net.ParseIP(c.RemoteIP())
+	if remote == nil {
+		return ""
+	}
+	if c.engine == nil || !c.engine.isTrustedProxy(remote) {
+		return remote.String()
+	}
+	for _, header := range c.engine.remoteIPHeaders {
+		var hops []string
+		if strings.EqualFold(header, "Forwarded") {
+			hops = parseForwarded(c.Req.Header.Values(header))
+		} else {
+			hops = splitHeader(c.Req.Header.Values(header))
+		}
+		if ip, ok := c.engine.clientFromChain(hops); ok {
+			return ip
+		}
+	}
+	return remote.String()
+}
+
+// clientFromChain walks the hops from the closest one, the first hop that isn't
+// a trusted proxy is the client. An invalid hop makes the whole chain unusable.
+func (engine *Engine) clientFromChain(hops []string) (string, bool) {
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseNode(hops[i])
+		if ip == nil {
+			return "", false
+		}
+		if i == 0 || !engine.isTrustedProxy(ip) {
+			return ip.String(), true
+		}
+	}
+	return "", false
+}
+
+// splitHeader splits comma separated values of every header line
+func splitHeader(values []string) []string {
+	hops := make([]string, 0)
+	for _, v := range values {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseForwarded returns the for= node of each element of RFC 7239 headers
+// Forwarded: for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"
+func parseForwarded(values []string) []string {
+	nodes := make([]string, 0)
+	for _, element := range splitHeader(values) {
+		node := ""
+		for _, pair := range strings.Split(element, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(k, "for") {
+				node = strings.Trim(v, `"`)
+			}
+		}
+		// an element without for= is an unknown hop
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// parseNode parses an IP with optional port, "[v6]:port", "v4:port" or a bare IP,
+// obfuscated identifiers ("unknown", "_hidden") give nil
+func parseNode(node string) net.IP {
+	if strings.HasPrefix(node, "[") {
+		end := strings.IndexByte(node, ']')
+		if end < 0 {
+			return nil
+		}
+		return net.ParseIP(node[1:end])
+	}
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return net.ParseIP(host)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func newIPContext(t *testing.T, remoteAddr string, headers map[string]string) *Context {
+	t.Helper()
+	c, _ := newTestContext("GET", "/")
+	if err := c.engine.SetTrustedProxies([]string{"10.0.0.0/8", "::1"}); err != nil {
+		t.Fatal(err)
+	}
+	c.Req = httptest.NewRequest("GET", "/", nil)
+	c.Req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		c.Req.Header.Set(k, v)
+	}
+	return c
+}
+
+func TestSetTrustedProxies(t *testing.T) {
+	r := New()
+	if err := r.SetTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Fatal("invalid proxy should be rejected")
+	}
+	if err := r.SetTrustedProxies([]string{"192.168.0.0/33"}); err == nil {
+		t.Fatal("invalid CIDR should be rejected")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cases := []struct {
+		name       string
+		remoteAddr string
+		// remote IP headers, the default when nil
+		ipHeaders []string
+		headers   map[string]string
+		clientIP  string
+	}{
+		{"direct client", "203.0.113.7:1234", nil, nil, "203.0.113.7"},
+		{"x-forwarded-for through proxy", "10.0.0.1:80", nil, map[string]string{"X-Forwarded-For": "198.51.100.2"}, "198.51.100.2"},
+		{"chain of trusted proxies", "10.0.0.1:80", nil, map[string]string{"X-Forwarded-For": "198.51.100.2, 10.0.0.3, 10.0.0.2"}, "198.51.100.2"},
+		{"x-real-ip through proxy", "10.0.0.1:80", []string{"X-Real-IP"}, map[string]string{"X-Real-IP": "198.51.100.3"}, "198.51.100.3"},
+		{"forwarded ipv4", "10.0.0.1:80", []string{"Forwarded"}, map[string]string{"Forwarded": "for=198.51.100.4;proto=https"}, "198.51.100.4"},
+		{"forwarded ipv6 with port", "[::1]:80", []string{"Forwarded"}, map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"headers are tried in order", "10.0.0.1:80", []string{"Forwarded", "X-Forwarded-For"}, map[string]string{"Forwarded": "for=198.51.100.4", "X-Forwarded-For": "198.51.100.2"}, "198.51.100.4"},
+		{"unusable header falls back", "10.0.0.1:80", []string{"Forwarded", "X-Forwarded-For"}, map[string]string{"Forwarded": "for=unknown", "X-Forwarded-For": "198.51.100.2"}, "198.51.100.2"},
+		{"proxy without headers", "10.0.0.1:80", nil, nil, "10.0.0.1"},
+	}
+	for _, tc := range cases {
+		c := newIPContext(t, tc.remoteAddr, tc.headers)
+		if tc.ipHeaders != nil {
+			c.engine.SetRemoteIPHeaders(tc.ipHeaders...)
+		}
+		if ip := c.ClientIP(); ip != tc.clientIP {
+			t.Fatalf("%s: expected %s, got %s", tc.name, tc.clientIP, ip)
+		}
+	}
+}
+
+func TestClientIPSpoofing(t *testing.T) {
+	// headers from an untrusted peer are ignored
+	c := newIPContext(t, "203.0.113.7:1234", map[string]string{
+		"X-Forwarded-For": "1.2.3.4",
+		"X-Real-IP":       "1.2.3.4",
+		"Forwarded":       "for=1.2.3.4",
+	})
+	if c.ClientIP() != "203.0.113.7" || c.RemoteIP() != "203.0.113.7" {
+		t.Fatal("untrusted peer must not choose its client IP")
+	}
+
+	// a client prepending a fake hop: the proxy appended the real peer, which wins
+	c = newIPContext(t, "10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.7"})
+	if c.ClientIP() != "203.0.113.7" {
+		t.Fatalf("prepended hops must be ignored, got %s", c.ClientIP())
+	}
+
+	// a client pretending to be a trusted proxy is still the right-most untrusted hop
+	c = newIPContext(t, "10.0.0.1:80", map[string]string{"Forwarded": "for=1.2.3.4, for=10.9.9.9, for=203.0.113.7"})
+	c.engine.SetRemoteIPHeaders("Forwarded")
+	if c.ClientIP() != "203.0.113.7" {
+		t.Fatalf("right-most untrusted hop expected, got %s", c.ClientIP())
+	}
+
+	// garbage in the chain makes the header unusable
+	c = newIPContext(t, "10.0.0.1:80", map[string]string{"X-Forwarded-For": "203.0.113.7, not-an-ip"})
+	if c.ClientIP() != "10.0.0.1" {
+		t.Fatalf("invalid chain should fall back to the peer, got %s", c.ClientIP())
+	}
+
+	// the proxy appends X-Forwarded-For only, the other headers come from the client
+	c = newIPContext(t, "10.0.0.1:80", map[string]string{
+		"Forwarded":       "for=1.2.3.4",
+		"X-Real-IP":       "1.2.3.4",
+		"X-Forwarded-For": "203.0.113.7",
+	})
+	if c.ClientIP() != "203.0.113.7" {
+		t.Fatalf("headers the proxy doesn't set must be ignored, got %s", c.ClientIP())
+	}
+
+	// nginx setting X-Real-IP only, a client supplied X-Forwarded-For is ignored
+	c = newIPContext(t, "10.0.0.1:80", map[string]string{"X-Real-IP": "203.0.113.7", "X-Forwarded-For": "1.2.3.4"})
+	c.engine.SetRemoteIPHeaders("X-Real-IP")
+	if c.ClientIP() != "203.0.113.7" {
+		t.Fatalf("only X-Real-IP should be read, got %s", c.ClientIP())
+	}
+}
@@ -1,9 +1,17 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // H is a shortcut for map[string]interface{} like gin
@@ -34,43 +42,307 @@ type H map[string]interface{}
 // and different types, html, json, plain text ...
 type Context struct {
 	Req    *http.Request
-	Writer http.ResponseWriter
+	Writer ResponseWriter // status and size are available through c.Writer.Status() and c.Writer.Size()
 	// request info
 	Method string
 	Path   string
 	Params map[string]string
 	// resp
+	// Deprecated: StatusCode is only kept up to date by SetStatus, use c.Writer.Status()
 	StatusCode int
+	writermem  responseWriter
 	// middleware
 	handlers []HandlerFunc
 	index    int
 	engine   *Engine // engine pointer used in HTML
+	// per request key/value store shared by middlewares and handlers
+	mu   sync.RWMutex
+	Keys map[string]interface{}
+	// errors collected with c.Error, rendered by ErrorHandler
+	Errors errorMsgs
+	// parsed once on first access, c.Req.URL.Query() parses on every call
+	queryCache url.Values
+	formCache  url.Values
+	// the body is parsed once, formErr keeps the failure for later accessors
+	formParsed bool
+	formErr    error
 }
 
+// abortIndex is far beyond any handler chain length, so that the index stays out of
+// range even after the c.index++ done by every Next()
+const abortIndex int = math.MaxInt32 / 2
+
+// Context can be handed to anything expecting a context.Context, e.g. db.QueryContext(c, ...)
+var _ context.Context = (*Context)(nil)
+
 // constructor func
 func newContext(w http.ResponseWriter, r *http.Request) *Context {
-	return &Context{
+	c := &Context{
 		Req:    r,
-		Writer: w,
 		Method: r.Method,
 		Path:   r.URL.Path,
 		index:  -1,
 	}
+	c.writermem.reset(w)
+	c.Writer = &c.writermem
+	return c
+}
+
+// Copy returns a read-only snapshot of c that is safe to use outside the
+// request, e.g. in a goroutine started by the handler. Params and Keys are
+// copied, the chain is empty and the writer refuses any write since the
+// response belongs to the original Context. The request is a shallow copy
+// whose context is detached: the copy keeps the values of the request context
+// and is never canceled, so it can outlive the request, e.g. db.QueryContext(cp, ...).
+// The copy never reads the body, the server closes it when the handler returns:
+// the query and the form values parsed before Copy are snapshotted, uploaded
+// files are not available.
+func (c *Context) Copy() *Context {
+	c.initQueryCache()
+	req := c.Req
+	if req != nil {
+		req = req.WithContext(detachedContext{req.Context()})
+		form := c.Req.Form
+		if form == nil {
+			form = c.queryCache
+		}
+		req.Form = cloneValues(form)
+		req.PostForm = cloneValues(c.Req.PostForm)
+		req.MultipartForm = nil
+		req.Body = http.NoBody
+	}
+	cp := &Context{
+		Req:        req,
+		Writer:     copiedWriter{},
+		Method:     c.Method,
+		Path:       c.Path,
+		StatusCode: c.StatusCode,
+		index:      abortIndex,
+		engine:     c.engine,
+	}
+	if c.Params != nil {
+		cp.Params = make(map[string]string, len(c.Params))
+		for k, v := range c.Params {
+			cp.Params[k] = v
+		}
+	}
+	c.mu.RLock()
+	if c.Keys != nil {
+		cp.Keys = make(map[string]interface{}, len(c.Keys))
+		for k, v := range c.Keys {
+			cp.Keys[k] = v
+		}
+	}
+	c.mu.RUnlock()
+	cp.Errors = append(cp.Errors, c.Errors...)
+	cp.queryCache = cloneValues(c.queryCache)
+	if req != nil {
+		cp.formCache = cloneValues(req.PostForm)
+	}
+	cp.formParsed, cp.formErr = true, c.formErr
+	return cp
+}
+
+// cloneValues deep copies values, nil gives an empty url.Values
+func cloneValues(values url.Values) url.Values {
+	cp := make(url.Values, len(values))
+	for k, v := range values {
+		cp[k] = append([]string(nil), v...)
+	}
+	return cp
 }
 
 // Next() maintains middleware stack
+// a middleware calling Next() after the chain was aborted is a no-op
+// the chain runs even when the client is gone, long running handlers watch c.Done()
 func (c *Context) Next() {
+	if c.IsAborted() {
+		return
+	}
 	c.index++
-	s := len(c.handlers)
-	for ; c.index < s; c.index++ {
+	for ; c.index < len(c.handlers); c.index++ {
 		c.handlers[c.index](c)
 	}
 }
 
-// Fail works as curcuit breaker, when called, all handlers after are skipped
+// Abort works as curcuit breaker, when called, all handlers after are skipped,
+// the handlers already running still finish their code after Next.
+// It doesn't write anything, e.g. an auth middleware can Abort and let ErrorHandler answer.
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted returns true if the chain was aborted
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// AbortWithStatus aborts the chain and sends the status code without body
+func (c *Context) AbortWithStatus(code int) {
+	c.Abort()
+	c.SetStatus(code)
+	c.Writer.WriteHeaderNow()
+}
+
+// AbortWithStatusJSON aborts the chain and writes obj as JSON body
+func (c *Context) AbortWithStatusJSON(code int, obj interface{}) {
+	c.Abort()
+	c.JSON(code, obj)
+}
+
+// Fail aborts the chain and answers err, err is recorded as a public error
+// and rendered in the same format as ErrorHandler
 func (c *Context) Fail(code int, err string) {
-	c.index = len(c.handlers)
-	c.JSON(code, H{"message": err})
+	c.Abort()
+	c.Error(errors.New(err)).SetType(ErrorTypePublic)
+	c.renderErrors(code)
+}
+
+// Set stores a value for this request only, it lazily inits c.Keys
+// e.g. an auth middleware does c.Set(UserIDKey, user.ID) before c.Next()
+func (c *Context) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Keys == nil {
+		c.Keys = make(map[string]interface{})
+	}
+	c.Keys[key] = value
+}
+
+// Get returns the value for the given key, exists is false if it was never Set
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, exists = c.Keys[key]
+	return
+}
+
+// MustGet returns the value for the given key or panics if it doesn't exist
+func (c *Context) MustGet(key string) interface{} {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic("Key \"" + key + "\" does not exist")
+}
+
+// GetAs returns the value for key asserted to T, ok is false when the key
+// doesn't exist or holds another type
+//
+//	user, ok := engine.GetAs[*User](c, "user")
+func GetAs[T any](c *Context, key string) (value T, ok bool) {
+	if v, exists := c.Get(key); exists {
+		value, ok = v.(T)
+	}
+	return
+}
+
+// typed getters return the zero value when the key is missing or has another type
+
+func (c *Context) GetString(key string) (s string) {
+	s, _ = GetAs[string](c, key)
+	return
+}
+
+func (c *Context) GetBool(key string) (b bool) {
+	b, _ = GetAs[bool](c, key)
+	return
+}
+
+func (c *Context) GetInt(key string) (i int) {
+	i, _ = GetAs[int](c, key)
+	return
+}
+
+func (c *Context) GetInt64(key string) (i64 int64) {
+	i64, _ = GetAs[int64](c, key)
+	return
+}
+
+func (c *Context) GetUint(key string) (ui uint) {
+	ui, _ = GetAs[uint](c, key)
+	return
+}
+
+func (c *Context) GetFloat64(key string) (f64 float64) {
+	f64, _ = GetAs[float64](c, key)
+	return
+}
+
+func (c *Context) GetTime(key string) (t time.Time) {
+	t, _ = GetAs[time.Time](c, key)
+	return
+}
+
+func (c *Context) GetDuration(key string) (d time.Duration) {
+	d, _ = GetAs[time.Duration](c, key)
+	return
+}
+
+func (c *Context) GetStringSlice(key string) (ss []string) {
+	ss, _ = GetAs[[]string](c, key)
+	return
+}
+
+func (c *Context) GetStringMap(key string) (sm map[string]interface{}) {
+	sm, _ = GetAs[map[string]interface{}](c, key)
+	return
+}
+
+func (c *Context) GetStringMapString(key string) (sms map[string]string) {
+	sms, _ = GetAs[map[string]string](c, key)
+	return
+}
+
+// context.Context implementation, deadline and cancellation come from c.Req.Context()
+
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	if c.Req == nil {
+		return
+	}
+	return c.Req.Context().Deadline()
+}
+
+// Done returns nil (never done) for a context without request
+func (c *Context) Done() <-chan struct{} {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Done()
+}
+
+func (c *Context) Err() error {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Err()
+}
+
+// Value looks up string keys in the Set store first, then falls back to the
+// request context
+func (c *Context) Value(key interface{}) interface{} {
+	if keyAsString, ok := key.(string); ok {
+		if value, exists := c.Get(keyAsString); exists {
+			return value
+		}
+	}
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Value(key)
+}
+
+// detachedContext keeps the values of its parent but not its deadline and
+// cancellation, the request context of a Copy
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+
+func (ctx detachedContext) Value(key interface{}) interface{} {
+	return ctx.parent.Value(key)
 }
 
 // basic method for wildcard Params
@@ -82,26 +354,165 @@ func (c *Context) Param(key string) string {
 // basic methods FormValue and Query
 // FormValue returns the first value for the named component of the query.
 // POST and PUT body parameters take precedence over URL query string values.
-// FormValue calls ParseMultipartForm and ParseForm if necessary and ignores
-// any errors returned by these functions.
+// FormValue parses the body with the engine MaxMultipartMemory, a parse error
+// (malformed or too large body) is recorded once with c.Error instead of being
+// dropped, so behind ErrorHandler such a request is answered with an error even
+// if the handler only set a success status.
 // If key is not present, FormValue returns the empty string.
-// To access multiple values of the same key, call ParseForm and
-// then inspect Request.Form directly.
 
 // methods has pointer receiver so that we can modify Context instance
 func (c *Context) FormValue(key string) string {
-	return c.Req.FormValue(key)
+	c.parseMultipartForm()
+	if c.Req.Form == nil {
+		return ""
+	}
+	return c.Req.Form.Get(key)
 }
 
+// initQueryCache parses the query string once per request
+func (c *Context) initQueryCache() {
+	if c.queryCache == nil {
+		if c.Req != nil {
+			c.queryCache = c.Req.URL.Query()
+		} else {
+			c.queryCache = url.Values{}
+		}
+	}
+}
+
+// Query returns the first value of the query key, "" if missing
+// GET /path?id=1234&name=Manu&value=
+//
+//	c.Query("id") == "1234"
+//	c.Query("value") == ""
+//	c.Query("wtf") == ""
 func (c *Context) Query(key string) string {
-	return c.Req.URL.Query().Get(key)
+	value, _ := c.GetQuery(key)
+	return value
+}
+
+// DefaultQuery returns defaultValue when the key doesn't exist, an empty
+// value still counts as existing
+func (c *Context) DefaultQuery(key string, defaultValue string) string {
+	if value, ok := c.GetQuery(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// GetQuery is like Query and tells whether the key exists
+// GET /?name=Manu&lastname=
+//
+//	("Manu", true) == c.GetQuery("name")
+//	("", false) == c.GetQuery("id")
+//	("", true) == c.GetQuery("lastname")
+func (c *Context) GetQuery(key string) (string, bool) {
+	if values, ok := c.GetQueryArray(key); ok {
+		return values[0], ok
+	}
+	return "", false
+}
+
+// QueryArray returns all the values of the query key, e.g. ?tag=a&tag=b
+func (c *Context) QueryArray(key string) []string {
+	values, _ := c.GetQueryArray(key)
+	return values
+}
+
+func (c *Context) GetQueryArray(key string) ([]string, bool) {
+	c.initQueryCache()
+	values, ok := c.queryCache[key]
+	return values, ok && len(values) > 0
 }
 
+// QueryMap collects the keys shaped like key[sub], ?filter[name]=x&filter[age]=18
+// gives {"name": "x", "age": "18"} for QueryMap("filter")
+func (c *Context) QueryMap(key string) map[string]string {
+	dicts, _ := c.GetQueryMap(key)
+	return dicts
+}
+
+func (c *Context) GetQueryMap(key string) (map[string]string, bool) {
+	c.initQueryCache()
+	return bracketMap(c.queryCache, key)
+}
+
+// initFormCache parses the urlencoded or multipart body once per request
+func (c *Context) initFormCache() {
+	if c.formCache == nil {
+		c.formCache = url.Values{}
+		if c.Req == nil {
+			return
+		}
+		c.parseMultipartForm()
+		for k, v := range c.Req.PostForm {
+			c.formCache[k] = v
+		}
+	}
+}
+
+// PostForm returns the first value of the body key, "" if missing.
+// Unlike FormValue it never looks at the query string.
+func (c *Context) PostForm(key string) string {
+	value, _ := c.GetPostForm(key)
+	return value
+}
+
+func (c *Context) DefaultPostForm(key string, defaultValue string) string {
+	if value, ok := c.GetPostForm(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func (c *Context) GetPostForm(key string) (string, bool) {
+	if values, ok := c.GetPostFormArray(key); ok {
+		return values[0], ok
+	}
+	return "", false
+}
+
+func (c *Context) PostFormArray(key string) []string {
+	values, _ := c.GetPostFormArray(key)
+	return values
+}
+
+func (c *Context) GetPostFormArray(key string) ([]string, bool) {
+	c.initFormCache()
+	values, ok := c.formCache[key]
+	return values, ok && len(values) > 0
+}
+
+func (c *Context) PostFormMap(key string) map[string]string {
+	dicts, _ := c.GetPostFormMap(key)
+	return dicts
+}
+
+func (c *Context) GetPostFormMap(key string) (map[string]string, bool) {
+	c.initFormCache()
+	return bracketMap(c.formCache, key)
+}
+
+// bracketMap extracts the key[sub]=value entries of values into {sub: value}
+func bracketMap(values url.Values, key string) (map[string]string, bool) {
+	dicts := make(map[string]string)
+	exist := false
+	for k, v := range values {
+		if i := strings.IndexByte(k, '['); i >= 1 && k[:i] == key {
+			if j := strings.IndexByte(k[i+1:], ']'); j >= 1 && len(v) > 0 {
+				exist = true
+				dicts[k[i+1:][:j]] = v[0]
+			}
+		}
+	}
+	return dicts, exist
+}
+
+// SetStatus records the status code, it is sent together with the headers
+// once the body starts, see ResponseWriter
 func (c *Context) SetStatus(code int) {
-	c.StatusCode = code
-	// WriteHeader sends an HTTP response header with the provided
-	// status code.
 	c.Writer.WriteHeader(code)
+	c.StatusCode = c.Writer.Status()
 }
 
 // src\net\http\header.go
@@ -137,10 +548,34 @@ func (c *Context) JSON(code int, obj interface{}) {
 }
 
 // day6 improve HMTL method so that it can render base on template name and data received
+// by the engine HTMLRender, see SetHTMLRender
+// the page is rendered into a pooled buffer first, so a failing template answers a
+// clean 500 instead of half a page; pages above the engine HTML buffer limit are streamed
 func (c *Context) HTML(code int, tmpl string, data interface{}) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	sw := &spillWriter{w: c.Writer, buf: buf, limit: c.engine.htmlBufferLimit}
+
+	render := c.engine.htmlRender
+	if render == nil {
+		render = noHTMLRender{}
+	}
 	c.SetHeader("Content-Type", "text/html")
 	c.SetStatus(code)
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, tmpl, data); err != nil {
-		c.Fail(500, err.Error())
+	if err := render.Render(sw, tmpl, data); err != nil {
+		var parseErr *templateParseError
+		if errors.As(err, &parseErr) && !sw.streaming {
+			c.templateError(parseErr.err)
+			return
+		}
+		c.Error(err)
+		c.Abort()
+		// no-op if streaming already started, the error is still logged by ErrorHandler
+		c.renderErrors(http.StatusInternalServerError)
+		return
+	}
+	if !sw.streaming {
+		c.SetHeader("Content-Length", strconv.Itoa(buf.Len()))
+		c.Writer.Write(buf.Bytes())
 	}
 }
@@ -0,0 +1,343 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestContext(method string, target string) (*Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c := newContext(w, httptest.NewRequest(method, target, nil))
+	c.engine = New()
+	return c, w
+}
+
+func TestContextKeys(t *testing.T) {
+	c, _ := newTestContext("GET", "/")
+	now := time.Now()
+	c.Set("name", "tom")
+	c.Set("age", 18)
+	c.Set("at", now)
+	c.Set("tags", []string{"a", "b"})
+
+	if c.GetString("name") != "tom" || c.GetInt("age") != 18 || !c.GetTime("at").Equal(now) {
+		t.Fatal("typed getters should return the stored values")
+	}
+	if len(c.GetStringSlice("tags")) != 2 {
+		t.Fatal("GetStringSlice should return the stored slice")
+	}
+	// wrong type or missing key gives the zero value
+	if c.GetString("age") != "" || c.GetInt("missing") != 0 {
+		t.Fatal("mismatched getters should return zero values")
+	}
+	if _, ok := GetAs[int](c, "name"); ok {
+		t.Fatal("GetAs should fail on type mismatch")
+	}
+	if v, ok := GetAs[string](c, "name"); !ok || v != "tom" {
+		t.Fatal("GetAs should return the stored value")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("MustGet should panic on missing key")
+		}
+	}()
+	c.MustGet("missing")
+}
+
+func TestContextKeysConcurrent(t *testing.T) {
+	c, _ := newTestContext("GET", "/")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Set("counter", i)
+			c.GetInt("counter")
+		}(i)
+	}
+	wg.Wait()
+	if _, ok := c.Get("counter"); !ok {
+		t.Fatal("counter should be set")
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	c, _ := newTestContext("GET", "/")
+	if logFields(c) != " client_ip=192.0.2.1" {
+		t.Fatalf("only the client IP expected without keys, got %q", logFields(c))
+	}
+	c.Set(RequestIDKey, "abc")
+	c.Set(UserIDKey, 42)
+	if logFields(c) != " client_ip=192.0.2.1 request_id=abc user_id=42" {
+		t.Fatalf("unexpected log fields %q", logFields(c))
+	}
+}
+
+type ctxKey struct{}
+
+func TestContextAsContext(t *testing.T) {
+	c, _ := newTestContext("GET", "/")
+	var ctx context.Context = c
+	c.Set("user", "tom")
+	c.Req = c.Req.WithContext(context.WithValue(c.Req.Context(), ctxKey{}, "trace"))
+	if ctx.Value("user") != "tom" || ctx.Value(ctxKey{}) != "trace" {
+		t.Fatal("Value should read the Set store then the request context")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("request is not canceled yet")
+	}
+}
+
+func TestContextCanceledRunsChain(t *testing.T) {
+	r := New()
+	logged := false
+	r.AppendMid(func(c *Context) {
+		c.Next()
+		logged = true
+	})
+	var handlerErr error
+	r.Get("/", func(c *Context) {
+		// the handler decides what to do with a canceled request
+		handlerErr = c.Err()
+		c.Plain(http.StatusOK, "late")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if !logged {
+		t.Fatal("middlewares should run for a canceled request")
+	}
+	if handlerErr != context.Canceled {
+		t.Fatalf("handler should see the cancellation, got %v", handlerErr)
+	}
+	if w.Body.String() != "late" {
+		t.Fatal("the chain should not be skipped")
+	}
+}
+
+func TestAbortNestedMiddleware(t *testing.T) {
+	r := New()
+	order := make([]string, 0)
+	r.AppendMid(func(c *Context) {
+		order = append(order, "outer-before")
+		c.Next()
+		order = append(order, "outer-after")
+		if !c.IsAborted() {
+			t.Fatal("outer middleware should see the abort")
+		}
+	})
+	v1 := r.Group("/v1")
+	v1.AppendMid(func(c *Context) {
+		order = append(order, "auth")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		// calling Next after Abort must not resume the chain
+		c.Next()
+		order = append(order, "auth-after")
+	})
+	v1.AppendMid(func(c *Context) {
+		order = append(order, "inner")
+		c.Next()
+	})
+	v1.Get("/secret", func(c *Context) {
+		order = append(order, "handler")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/secret", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+	expected := []string{"outer-before", "auth", "auth-after", "outer-after"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("unexpected execution order %v", order)
+	}
+}
+
+func TestAbortWithStatusJSON(t *testing.T) {
+	r := New()
+	r.AppendMid(func(c *Context) {
+		c.AbortWithStatusJSON(http.StatusForbidden, H{"message": "forbidden"})
+	})
+	called := false
+	r.Get("/", func(c *Context) {
+		called = true
+	})
+	code, obj := serveJSON(t, r, "GET", "/")
+	if called || code != http.StatusForbidden || obj["message"] != "forbidden" {
+		t.Fatalf("unexpected abort response %d %v", code, obj)
+	}
+}
+
+func TestAbortWithoutWriting(t *testing.T) {
+	c, w := newTestContext("GET", "/")
+	c.handlers = []HandlerFunc{
+		func(c *Context) { c.Abort() },
+		func(c *Context) { c.Plain(http.StatusOK, "unreachable") },
+	}
+	c.Next()
+	if !c.IsAborted() || w.Body.Len() != 0 {
+		t.Fatal("Abort should skip the rest of the chain without writing")
+	}
+}
+
+func TestQueryAccessors(t *testing.T) {
+	c, _ := newTestContext("GET", "/?id=1&empty=&tag=a&tag=b&filter[name]=tom&filter[age]=18")
+	if c.Query("id") != "1" || c.DefaultQuery("missing", "x") != "x" || c.DefaultQuery("empty", "x") != "" {
+		t.Fatal("Query/DefaultQuery mismatch")
+	}
+	if _, ok := c.GetQuery("empty"); !ok {
+		t.Fatal("empty value should exist")
+	}
+	if _, ok := c.GetQuery("missing"); ok {
+		t.Fatal("missing key should not exist")
+	}
+	if !reflect.DeepEqual(c.QueryArray("tag"), []string{"a", "b"}) {
+		t.Fatal("QueryArray should return all values")
+	}
+	if !reflect.DeepEqual(c.QueryMap("filter"), map[string]string{"name": "tom", "age": "18"}) {
+		t.Fatalf("unexpected QueryMap %v", c.QueryMap("filter"))
+	}
+	if _, ok := c.GetQueryMap("tag"); ok {
+		t.Fatal("tag is not a map")
+	}
+
+	// the parsed query is cached for the request
+	c.Req.URL.RawQuery = "id=2"
+	if c.Query("id") != "1" {
+		t.Fatal("query should be parsed only once")
+	}
+}
+
+func TestPostFormAccessors(t *testing.T) {
+	c, _ := newTestContext("POST", "/?name=query")
+	body := "name=form&tag=a&tag=b&user[name]=tom"
+	c.Req = httptest.NewRequest("POST", "/?name=query&only=query", strings.NewReader(body))
+	c.Req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if c.PostForm("name") != "form" || c.PostForm("only") != "" || c.DefaultPostForm("missing", "x") != "x" {
+		t.Fatal("PostForm should only read the body")
+	}
+	if !reflect.DeepEqual(c.PostFormArray("tag"), []string{"a", "b"}) {
+		t.Fatal("PostFormArray should return all values")
+	}
+	if !reflect.DeepEqual(c.PostFormMap("user"), map[string]string{"name": "tom"}) {
+		t.Fatalf("unexpected PostFormMap %v", c.PostFormMap("user"))
+	}
+	if c.FormValue("only") != "query" {
+		t.Fatal("FormValue still falls back to the query")
+	}
+}
+
+func TestContextCopy(t *testing.T) {
+	c, _ := newTestContext("GET", "/hello/tom")
+	c.Params = map[string]string{"name": "tom"}
+	c.Set(UserIDKey, 42)
+
+	cp := c.Copy()
+	c.Params["name"] = "bob"
+	c.Set(UserIDKey, 43)
+	if cp.Param("name") != "tom" || cp.GetInt(UserIDKey) != 42 || cp.Path != "/hello/tom" {
+		t.Fatal("copy should be a snapshot of params, keys and request metadata")
+	}
+	if !cp.IsAborted() {
+		t.Fatal("copy has no chain to run")
+	}
+	// Fail only records on a copy
+	cp.Fail(http.StatusInternalServerError, "ignored")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("writing through a copy should panic")
+		}
+	}()
+	cp.Plain(http.StatusOK, "hello")
+}
+
+func TestContextCopyOutlivesRequest(t *testing.T) {
+	c, _ := newTestContext("GET", "/")
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "trace"))
+	c.Req = c.Req.WithContext(ctx)
+	cp := c.Copy()
+	// the handler returned
+	cancel()
+	if c.Err() == nil {
+		t.Fatal("original context should be canceled")
+	}
+	if cp.Err() != nil || cp.Done() != nil {
+		t.Fatal("copy should not be canceled with the request")
+	}
+	if _, ok := cp.Deadline(); ok {
+		t.Fatal("copy should not inherit the request deadline")
+	}
+	if cp.Value(ctxKey{}) != "trace" {
+		t.Fatal("copy should keep the values of the request context")
+	}
+}
+
+func TestContextCopyForm(t *testing.T) {
+	newFormContext := func() *Context {
+		c, _ := newTestContext("POST", "/?page=2")
+		c.Req = httptest.NewRequest("POST", "/?page=2", strings.NewReader("name=tom"))
+		c.Req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return c
+	}
+
+	c := newFormContext()
+	c.PostForm("name")
+	cp := c.Copy()
+	if cp.Query("page") != "2" || cp.PostForm("name") != "tom" || cp.FormValue("name") != "tom" {
+		t.Fatal("copy should snapshot the query and the parsed form")
+	}
+	c.Req.PostForm.Set("name", "bob")
+	if cp.PostForm("name") != "tom" {
+		t.Fatal("copy should not share the form values")
+	}
+
+	// a copy made before the body is parsed leaves it to the handler
+	c = newFormContext()
+	cp = c.Copy()
+	if cp.PostForm("name") != "" || cp.FormValue("page") != "2" {
+		t.Fatal("copy should not read the body")
+	}
+	if c.PostForm("name") != "tom" {
+		t.Fatal("the body should still be readable by the handler")
+	}
+}
+
+// logSink hands each log line to the test goroutine
+type logSink chan string
+
+func (s logSink) Write(p []byte) (int, error) {
+	s <- string(p)
+	return len(p), nil
+}
+
+func TestContextGoRecovers(t *testing.T) {
+	sink := make(logSink, 1)
+	log.SetOutput(sink)
+	defer log.SetOutput(os.Stderr)
+
+	c, _ := newTestContext("GET", "/")
+	c.Set(RequestIDKey, "req-1")
+	c.Go(func(c *Context) {
+		panic("background failure")
+	})
+	select {
+	case line := <-sink:
+		if !strings.Contains(line, "background failure") || !strings.Contains(line, "request_id=req-1") {
+			t.Fatalf("panic should be logged with the request fields, got %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic of the goroutine wasn't logged")
+	}
+}
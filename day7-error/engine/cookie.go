@@ -0,0 +1,187 @@
+// cookie helpers, plain, signed (HMAC) and encrypted (AES-GCM) with key rotation
+package engine
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrNoCookieKeys  = errors.New("cookie: no key configured on the engine")
+	ErrInvalidCookie = errors.New("cookie: invalid signature or ciphertext")
+)
+
+// CookieOptions are the attributes c.SetCookie applies to every cookie
+type CookieOptions struct {
+	Path     string
+	Domain   string
+	SameSite http.SameSite
+	// Secure forces the Secure attribute, it is always set on TLS requests
+	Secure   bool
+	HttpOnly bool
+}
+
+// defaultCookieOptions keeps cookies away from scripts and cross-site requests
+var defaultCookieOptions = CookieOptions{
+	Path:     "/",
+	SameSite: http.SameSiteLaxMode,
+	HttpOnly: true,
+}
+
+// SetCookieOptions replaces the default cookie attributes
+func (engine *Engine) SetCookieOptions(opts CookieOptions) {
+	engine.cookieOptions = opts
+}
+
+// SetSigningKeys sets the HMAC keys of signed cookies. The first key signs new
+// cookies, all of them are accepted when verifying, so a key can be rotated by
+// prepending the new one and removing the old one once its cookies expired.
+func (engine *Engine) SetSigningKeys(keys ...[]byte) {
+	engine.signingKeys = keys
+}
+
+// SetEncryptionKeys sets the AES keys (16, 24 or 32 bytes) of encrypted cookies,
+// rotation works like SetSigningKeys
+func (engine *Engine) SetEncryptionKeys(keys ...[]byte) error {
+	aeads := make([]cipher.AEAD, 0, len(keys))
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return fmt.Errorf("cookie: encryption key %d: %w", i, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		aeads = append(aeads, aead)
+	}
+	engine.encryptionKeys = aeads
+	return nil
+}
+
+// Cookie returns the unescaped value of the named cookie or http.ErrNoCookie
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(cookie.Value)
+}
+
+// SetCookie sets a cookie with the engine defaults, maxAge < 0 deletes it and
+// maxAge == 0 makes it a session cookie
+func (c *Context) SetCookie(name string, value string, maxAge int) {
+	opts := c.engine.cookieOptions
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    url.QueryEscape(value),
+		MaxAge:   maxAge,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		SameSite: opts.SameSite,
+		Secure:   opts.Secure || c.Req.TLS != nil,
+		HttpOnly: opts.HttpOnly,
+	})
+}
+
+// SetSignedCookie sets a cookie readable by the client but tamper proof,
+// the signature covers the cookie name so values can't be swapped between cookies
+func (c *Context) SetSignedCookie(name string, value string, maxAge int) error {
+	keys := c.engine.signingKeys
+	if len(keys) == 0 {
+		return ErrNoCookieKeys
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value))
+	mac := cookieMAC(keys[0], name, payload)
+	c.SetCookie(name, payload+"."+base64.RawURLEncoding.EncodeToString(mac), maxAge)
+	return nil
+}
+
+// SignedCookie returns the value of a cookie set by SetSignedCookie,
+// ErrInvalidCookie means the cookie was forged or signed with an unknown key
+func (c *Context) SignedCookie(name string) (string, error) {
+	keys := c.engine.signingKeys
+	if len(keys) == 0 {
+		return "", ErrNoCookieKeys
+	}
+	raw, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	payload, sig, ok := strings.Cut(raw, ".")
+	if !ok {
+		return "", ErrInvalidCookie
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range keys {
+		if hmac.Equal(mac, cookieMAC(key, name, payload)) {
+			value, err := base64.RawURLEncoding.DecodeString(payload)
+			if err != nil {
+				return "", ErrInvalidCookie
+			}
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// SetEncryptedCookie sets a cookie whose value is hidden from the client,
+// AES-GCM also authenticates it, the cookie name is bound as additional data
+func (c *Context) SetEncryptedCookie(name string, value string, maxAge int) error {
+	aeads := c.engine.encryptionKeys
+	if len(aeads) == 0 {
+		return ErrNoCookieKeys
+	}
+	aead := aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	c.SetCookie(name, base64.RawURLEncoding.EncodeToString(sealed), maxAge)
+	return nil
+}
+
+// EncryptedCookie returns the value of a cookie set by SetEncryptedCookie
+func (c *Context) EncryptedCookie(name string) (string, error) {
+	aeads := c.engine.encryptionKeys
+	if len(aeads) == 0 {
+		return "", ErrNoCookieKeys
+	}
+	raw, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, aead := range aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if value, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+func cookieMAC(key []byte, name string, payload string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(name + "=" + payload))
+	return h.Sum(nil)
+}
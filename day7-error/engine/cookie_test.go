@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// roundTrip copies the cookies set on w into a new request
+func roundTrip(w *httptest.ResponseRecorder) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestSetCookieDefaults(t *testing.T) {
+	c, w := newTestContext("GET", "/")
+	c.SetCookie("lang", "zh cn", 3600)
+	cookie := w.Result().Cookies()[0]
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" || cookie.Secure {
+		t.Fatalf("unexpected cookie attributes %v", cookie)
+	}
+	c.Req = roundTrip(w)
+	if v, err := c.Cookie("lang"); err != nil || v != "zh cn" {
+		t.Fatalf("unexpected cookie value %q %v", v, err)
+	}
+	if _, err := c.Cookie("missing"); err != http.ErrNoCookie {
+		t.Fatal("missing cookie should return http.ErrNoCookie")
+	}
+}
+
+func TestSignedCookie(t *testing.T) {
+	c, w := newTestContext("GET", "/")
+	if err := c.SetSignedCookie("user", "tom", 0); err != ErrNoCookieKeys {
+		t.Fatal("signing without keys should fail")
+	}
+	oldKey := []byte("old-secret")
+	c.engine.SetSigningKeys(oldKey)
+	c.SetSignedCookie("user", "tom", 0)
+
+	// rotate: new key first, old cookies still verify
+	c.engine.SetSigningKeys([]byte("new-secret"), oldKey)
+	c.Req = roundTrip(w)
+	if v, err := c.SignedCookie("user"); err != nil || v != "tom" {
+		t.Fatalf("unexpected signed value %q %v", v, err)
+	}
+
+	// once the old key is dropped the cookie is rejected
+	c.engine.SetSigningKeys([]byte("new-secret"))
+	if _, err := c.SignedCookie("user"); err != ErrInvalidCookie {
+		t.Fatal("cookie signed with a removed key should be rejected")
+	}
+
+	// tampering or moving the value to another cookie is detected
+	cookie := w.Result().Cookies()[0]
+	c.engine.SetSigningKeys(oldKey)
+	c.Req = httptest.NewRequest("GET", "/", nil)
+	c.Req.AddCookie(&http.Cookie{Name: "admin", Value: cookie.Value})
+	if _, err := c.SignedCookie("admin"); err != ErrInvalidCookie {
+		t.Fatal("signature should be bound to the cookie name")
+	}
+}
+
+func TestEncryptedCookie(t *testing.T) {
+	c, w := newTestContext("GET", "/")
+	if err := c.engine.SetEncryptionKeys([]byte("short")); err == nil {
+		t.Fatal("invalid AES key size should be rejected")
+	}
+	oldKey := bytes.Repeat([]byte("k"), 32)
+	c.engine.SetEncryptionKeys(oldKey)
+	c.SetEncryptedCookie("session", "secret-value", 0)
+	if bytes.Contains([]byte(w.Result().Cookies()[0].Value), []byte("secret")) {
+		t.Fatal("encrypted cookie must not contain the plain value")
+	}
+
+	c.engine.SetEncryptionKeys(bytes.Repeat([]byte("n"), 16), oldKey)
+	c.Req = roundTrip(w)
+	if v, err := c.EncryptedCookie("session"); err != nil || v != "secret-value" {
+		t.Fatalf("unexpected decrypted value %q %v", v, err)
+	}
+	c.engine.SetEncryptionKeys(bytes.Repeat([]byte("n"), 16))
+	if _, err := c.EncryptedCookie("session"); err != ErrInvalidCookie {
+		t.Fatal("cookie encrypted with a removed key should be rejected")
+	}
+}
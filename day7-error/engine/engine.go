@@ -1,11 +1,13 @@
 package engine
 
 import (
+	"crypto/cipher"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
-	"path"
 	"strings"
 )
 
@@ -38,16 +40,40 @@ type RouterGroup struct {
 
 // Engine implement the interface of ServeHTTP, difference is HandlerFunc takes Context as argument
 type Engine struct {
-	*RouterGroup  //embedded type
-	router        *router
-	groups        []*RouterGroup     // store all groups into engine
-	htmlTemplates *template.Template // for html render
-	funcMap       template.FuncMap   // for html render
+	*RouterGroup //embedded type
+	router       *router
+	groups       []*RouterGroup   // store all groups into engine
+	htmlRender   HTMLRender       // for html render
+	funcMap      template.FuncMap // for html render
+	// pages larger than htmlBufferLimit bytes are streamed instead of buffered
+	htmlBufferLimit int
+	// cookie defaults and keys, see cookie.go
+	cookieOptions  CookieOptions
+	signingKeys    [][]byte
+	encryptionKeys []cipher.AEAD
+	// memory used to parse multipart bodies, see upload.go
+	maxMultipartMemory int64
+	// proxies whose forwarding headers are trusted, see clientip.go
+	trustedCIDRs []*net.IPNet
+	// headers carrying the client IP set by those proxies
+	remoteIPHeaders []string
+	// handlers of unknown routes and missing static files
+	noRoute []HandlerFunc
+	// fingerprinted names for the asset template func, see assets.go
+	assets *assetManifest
+	// development mode, see template_reload.go
+	debug bool
 }
 
 // New is the constructor of Engine, init the router map
 func New() *Engine {
-	engine := &Engine{router: newRouter()}
+	engine := &Engine{
+		router:             newRouter(),
+		htmlBufferLimit:    defaultHTMLBufferLimit,
+		cookieOptions:      defaultCookieOptions,
+		maxMultipartMemory: defaultMultipartMemory,
+		remoteIPHeaders:    defaultRemoteIPHeaders,
+	}
 	engine.RouterGroup = &RouterGroup{engine: engine}
 	engine.groups = []*RouterGroup{engine.RouterGroup}
 	// fmt.Printf("group size %d\n", len(engine.groups)) // size = 1
@@ -59,9 +85,84 @@ func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 	engine.funcMap = funcMap
 }
 
+// SetHTMLBufferLimit sets the size in bytes up to which c.HTML buffers a page
+// before committing it, larger pages are streamed and can't turn into a 500 anymore
+func (engine *Engine) SetHTMLBufferLimit(limit int) {
+	engine.htmlBufferLimit = limit
+}
+
 // tell it where to find our HTML templates with engine.LoadHTMLGlob("templates/*"). This will load all templates in the templates directory.
+// in debug mode the files are watched instead and a parse error doesn't panic
 func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+	parse := func() (htmlExecutor, error) {
+		return template.New("").Funcs(engine.templateFuncs()).ParseGlob(pattern)
+	}
+	engine.loadHTML(parse, func() (string, error) {
+		return globSignature(pattern)
+	})
+}
+
+// LoadHTMLFiles works like LoadHTMLGlob with a list of files
+func (engine *Engine) LoadHTMLFiles(files ...string) {
+	parse := func() (htmlExecutor, error) {
+		return template.New("").Funcs(engine.templateFuncs()).ParseFiles(files...)
+	}
+	engine.loadHTML(parse, func() (string, error) {
+		return fileSignature(files...)
+	})
+}
+
+// LoadHTMLFS works like LoadHTMLGlob with the files of fsys matching patterns,
+// e.g. templates embedded in the binary
+//
+//	//go:embed templates
+//	var templatesFS embed.FS
+//
+//	r.LoadHTMLFS(templatesFS, "templates/*.tmpl")
+func (engine *Engine) LoadHTMLFS(fsys fs.FS, patterns ...string) {
+	parse := func() (htmlExecutor, error) {
+		return template.New("").Funcs(engine.templateFuncs()).ParseFS(fsys, patterns...)
+	}
+	engine.loadHTML(parse, func() (string, error) {
+		return fsGlobSignature(fsys, patterns...)
+	})
+}
+
+// SetHTMLRender replaces the renderer of c.HTML, e.g. another template engine
+// or TextTemplate. The Load* methods set a renderer too, the last call wins.
+func (engine *Engine) SetHTMLRender(render HTMLRender) {
+	engine.htmlRender = render
+}
+
+// loadHTML parses the templates now, or again on every change of signature in debug mode
+func (engine *Engine) loadHTML(parse func() (htmlExecutor, error), signature func() (string, error)) {
+	if engine.debug {
+		engine.htmlRender = newTemplateReloader(parse, signature)
+		return
+	}
+	tmpl, err := parse()
+	if err != nil {
+		panic(err)
+	}
+	engine.htmlRender = executorRender{tmpl}
+}
+
+// templateFuncs is the funcMap plus the builtin asset func, a func of the
+// funcMap with the same name wins
+func (engine *Engine) templateFuncs() template.FuncMap {
+	funcs := template.FuncMap{
+		"asset": engine.assetFunc,
+	}
+	for name, fn := range engine.funcMap {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// NoRoute sets the handlers answering unknown routes and missing static files,
+// they run after the group middlewares with the status already set to 404
+func (engine *Engine) NoRoute(handlers ...HandlerFunc) {
+	engine.noRoute = handlers
 }
 
 // Group is defined to create a new RouterGroup
@@ -99,44 +200,13 @@ func (group *RouterGroup) AppendMid(middlewares ...HandlerFunc) {
 	group.middlewares = append(group.middlewares, middlewares...)
 }
 
-// Default use Logger() & Recovery middlewares, Logger should be first as it records timeframe
+// Default use Logger(), Recovery() & ErrorHandler() middlewares, Logger should be first as it records timeframe
 func Default() *Engine {
 	engine := New()
-	engine.AppendMid(Logger(), Recovery())
+	engine.AppendMid(Logger(), Recovery(), ErrorHandler())
 	return engine
 }
 
-// create static handler
-func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileSystem) HandlerFunc {
-	absolutePath := path.Join(group.prefix, relativePath)
-	// http.StripPrefix(absolutePath, ...) removes the absolutePath prefix from the request URL before
-	// passing it to the file server. This ensures that the correct file is served based on the relative path.
-	// e.g. r.Static("/assets", "/usr/geektutu/blog/static")
-	// here xxx/assets/*filepath removes xxx/assets/ and leave the correct file path
-	// so user localhost:9999/assets/js/geektutu.js returns /usr/geektutu/blog/static/js/geektutu.js
-	fileServer := http.StripPrefix(absolutePath, http.FileServer(fs))
-	return func(c *Context) {
-		file := c.Param("filepath")
-		// Check if file exists and/or if we have permission to access it
-		if _, err := fs.Open(file); err != nil {
-			c.SetStatus(http.StatusNotFound)
-			return
-		}
-
-		fileServer.ServeHTTP(c.Writer, c.Req)
-	}
-}
-
-// GET relativePath/*filepath to map fs root path to relativePath
-// r.Static("/assets", "/usr/geektutu/blog/static") so when requesting
-// localhost:9999/assets/js/geektutu.js, it returns /usr/geektutu/blog/static/js/geektutu.js
-func (group *RouterGroup) Static(relativePath string, root string) {
-	handler := group.createStaticHandler(relativePath, http.Dir(root))
-	urlPattern := path.Join(relativePath, "/*filepath")
-	// Register GET handlers
-	group.Get(urlPattern, handler)
-}
-
 // day5 update when request reached, all middlewares belong to be URL group
 // are added before the request handler
 // implement the Handler interface as Engine pointer as we need to modify Engine map
@@ -151,6 +221,8 @@ func (engine *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	c.handlers = middlewares
 	c.engine = engine
 	engine.router.handleRoute(c)
+	// flush a status recorded with SetStatus/WriteHeader that no body write sent yet
+	c.Writer.WriteHeaderNow()
 }
 
 // Run defines the method to start a http server
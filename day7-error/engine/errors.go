@@ -0,0 +1,193 @@
+// error accumulation for Context and the centralized ErrorHandler middleware
+package engine
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ErrorType tells ErrorHandler who may see an error, private errors are only logged
+type ErrorType uint64
+
+const (
+	// ErrorTypePrivate is the default type of c.Error, it never reaches the client
+	ErrorTypePrivate ErrorType = 1 << 0
+	// ErrorTypePublic errors are rendered in the response body
+	ErrorTypePublic ErrorType = 1 << 1
+	// ErrorTypeAny matches every type in ByType
+	ErrorTypeAny ErrorType = 1<<64 - 1
+)
+
+// Error wraps an error collected with c.Error
+type Error struct {
+	Err  error
+	Type ErrorType
+	Meta interface{}
+}
+
+type errorMsgs []*Error
+
+var _ error = (*Error)(nil)
+
+func (msg *Error) Error() string {
+	return msg.Err.Error()
+}
+
+func (msg *Error) Unwrap() error {
+	return msg.Err
+}
+
+// SetType sets the error type, it returns msg for chaining
+//
+//	c.Error(err).SetType(engine.ErrorTypePublic).SetMeta(engine.H{"field": "name"})
+func (msg *Error) SetType(flags ErrorType) *Error {
+	msg.Type = flags
+	return msg
+}
+
+// SetMeta attaches extra data rendered next to a public error
+func (msg *Error) SetMeta(data interface{}) *Error {
+	msg.Meta = data
+	return msg
+}
+
+func (msg *Error) IsType(flags ErrorType) bool {
+	return (msg.Type & flags) > 0
+}
+
+// JSON returns the rendered form of the error, H metadata is merged into it
+func (msg *Error) JSON() interface{} {
+	obj := H{}
+	if msg.Meta != nil {
+		if meta, ok := msg.Meta.(H); ok {
+			for k, v := range meta {
+				obj[k] = v
+			}
+		} else {
+			obj["meta"] = msg.Meta
+		}
+	}
+	obj["error"] = msg.Error()
+	return obj
+}
+
+// ByType returns the errors matching flags
+func (a errorMsgs) ByType(flags ErrorType) errorMsgs {
+	if len(a) == 0 {
+		return nil
+	}
+	if flags == ErrorTypeAny {
+		return a
+	}
+	var result errorMsgs
+	for _, msg := range a {
+		if msg.IsType(flags) {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// Last returns the most recent error or nil
+func (a errorMsgs) Last() *Error {
+	if length := len(a); length > 0 {
+		return a[length-1]
+	}
+	return nil
+}
+
+// Errors returns the messages of all errors
+func (a errorMsgs) Errors() []string {
+	if len(a) == 0 {
+		return nil
+	}
+	errorStrings := make([]string, len(a))
+	for i, msg := range a {
+		errorStrings[i] = msg.Error()
+	}
+	return errorStrings
+}
+
+// JSON returns the rendered form of all errors
+func (a errorMsgs) JSON() []interface{} {
+	result := make([]interface{}, len(a))
+	for i, msg := range a {
+		result[i] = msg.JSON()
+	}
+	return result
+}
+
+func (a errorMsgs) String() string {
+	var str strings.Builder
+	for i, msg := range a {
+		str.WriteString(fmt.Sprintf("Error #%02d: %s\n", i+1, msg.Err))
+		if msg.Meta != nil {
+			str.WriteString(fmt.Sprintf("     Meta: %v\n", msg.Meta))
+		}
+	}
+	return str.String()
+}
+
+// Error attaches an error to the current context, it doesn't write anything,
+// ErrorHandler renders the collected errors once the chain is done.
+// Errors are private unless SetType(ErrorTypePublic) is called on the result.
+func (c *Context) Error(err error) *Error {
+	if err == nil {
+		panic("err is nil")
+	}
+	parsedError, ok := err.(*Error)
+	if !ok {
+		parsedError = &Error{
+			Err:  err,
+			Type: ErrorTypePrivate,
+		}
+	}
+	c.Errors = append(c.Errors, parsedError)
+	return parsedError
+}
+
+// renderErrors writes the single error format of the framework:
+// {"message": <last public error or status text>, "errors": [<public errors>]}
+// Nothing is written if the response already started, the errors are only recorded.
+func (c *Context) renderErrors(code int) {
+	if c.Writer.Written() {
+		return
+	}
+	obj := H{"message": http.StatusText(code)}
+	if public := c.Errors.ByType(ErrorTypePublic); len(public) > 0 {
+		obj["message"] = public.Last().Error()
+		obj["errors"] = public.JSON()
+	}
+	c.JSON(code, obj)
+}
+
+// ErrorHandler renders the errors collected with c.Error once the rest of the
+// chain returned and nothing has been written yet. An error status set by the
+// handler (c.SetStatus(http.StatusConflict)) is kept, otherwise public errors
+// answer 400 and private ones 500 with a generic message; private errors are only logged.
+func ErrorHandler() HandlerFunc {
+	return func(c *Context) {
+		c.Next()
+		if len(c.Errors) == 0 {
+			return
+		}
+		if private := c.Errors.ByType(ErrorTypePrivate); len(private) > 0 {
+			log.Printf("%s %s%s\n%s", c.Method, c.Path, logFields(c), private.String())
+		}
+		// a handler already answered, e.g. through Fail
+		if c.Writer.Written() {
+			return
+		}
+		// the status is only recorded until the headers are sent
+		code := c.Writer.Status()
+		if code < http.StatusBadRequest {
+			code = http.StatusInternalServerError
+			if len(c.Errors.ByType(ErrorTypePrivate)) == 0 {
+				code = http.StatusBadRequest
+			}
+		}
+		c.renderErrors(code)
+	}
+}
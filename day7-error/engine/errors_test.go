@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveJSON(t *testing.T, r *Engine, method string, target string) (int, H) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	obj := H{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &obj); err != nil {
+			t.Fatalf("invalid json body %q", w.Body.String())
+		}
+	}
+	return w.Code, obj
+}
+
+func TestErrorTypes(t *testing.T) {
+	c, _ := newTestContext("GET", "/")
+	c.Error(errors.New("db down"))
+	c.Error(errors.New("name is required")).SetType(ErrorTypePublic).SetMeta(H{"field": "name"})
+
+	if len(c.Errors) != 2 || len(c.Errors.ByType(ErrorTypePublic)) != 1 {
+		t.Fatal("errors should be collected by type")
+	}
+	if c.Errors.Last().Error() != "name is required" {
+		t.Fatal("Last should return the latest error")
+	}
+	obj := c.Errors.Last().JSON().(H)
+	if obj["error"] != "name is required" || obj["field"] != "name" {
+		t.Fatalf("unexpected error json %v", obj)
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	r := New()
+	r.AppendMid(ErrorHandler())
+	r.Get("/public", func(c *Context) {
+		c.Error(errors.New("name is required")).SetType(ErrorTypePublic)
+	})
+	r.Get("/private", func(c *Context) {
+		c.Error(errors.New("password=hunter2 rejected by db"))
+	})
+	r.Get("/conflict", func(c *Context) {
+		c.SetStatus(http.StatusConflict)
+		c.Error(errors.New("name already taken")).SetType(ErrorTypePublic)
+	})
+	r.Get("/written", func(c *Context) {
+		c.Error(errors.New("logged only"))
+		c.JSON(http.StatusOK, H{"ok": true})
+	})
+
+	code, obj := serveJSON(t, r, "GET", "/public")
+	if code != http.StatusBadRequest || obj["message"] != "name is required" {
+		t.Fatalf("public error should be rendered, got %d %v", code, obj)
+	}
+
+	code, obj = serveJSON(t, r, "GET", "/private")
+	if code != http.StatusInternalServerError || obj["message"] != "Internal Server Error" || obj["errors"] != nil {
+		t.Fatalf("private error should stay out of the response, got %d %v", code, obj)
+	}
+
+	code, obj = serveJSON(t, r, "GET", "/conflict")
+	if code != http.StatusConflict || obj["message"] != "name already taken" {
+		t.Fatalf("status set by the handler should be kept, got %d %v", code, obj)
+	}
+
+	code, obj = serveJSON(t, r, "GET", "/written")
+	if code != http.StatusOK || obj["ok"] != true {
+		t.Fatal("ErrorHandler should not overwrite a written response")
+	}
+}
+
+func TestFailUsesErrorFormat(t *testing.T) {
+	r := New()
+	r.AppendMid(ErrorHandler())
+	r.Get("/", func(c *Context) {
+		c.Fail(http.StatusUnauthorized, "unauthorized")
+	})
+	code, obj := serveJSON(t, r, "GET", "/")
+	if code != http.StatusUnauthorized || obj["message"] != "unauthorized" || len(obj["errors"].([]interface{})) != 1 {
+		t.Fatalf("unexpected Fail response %d %v", code, obj)
+	}
+}
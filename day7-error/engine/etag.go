@@ -0,0 +1,229 @@
+// entity tags and conditional requests (RFC 7232) for dynamic responses
+package engine
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ComputeETag returns a quoted entity tag for data, a rendered body or any
+// version of the resource (e.g. []byte(strconv.Itoa(row.Version))). A weak tag
+// W/"..." only promises an equivalent representation, not the same bytes.
+func ComputeETag(data []byte, weak bool) string {
+	sum := sha256.Sum256(data)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// CheckConditions evaluates the conditional headers of the request against the
+// current etag and lastModified of an existing resource, "" and the zero time
+// mean unknown. For GET and HEAD the ETag and Last-Modified headers are set and a
+// still valid cached copy is answered with 304. A failed If-Match,
+// If-Unmodified-Since, or If-None-Match on other methods is answered with 412,
+// which makes optimistic concurrency for writes a one liner:
+//
+//	if c.CheckConditions(ComputeETag([]byte(version), false), time.Time{}) {
+//	    return
+//	}
+//
+// It returns true if the response was sent and the handler must stop.
+func (c *Context) CheckConditions(etag string, lastModified time.Time) bool {
+	safe := c.Method == http.MethodGet || c.Method == http.MethodHead
+	if safe {
+		if etag != "" {
+			c.SetHeader("ETag", etag)
+		}
+		if !lastModified.IsZero() {
+			c.SetHeader("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		}
+	}
+	// HTTP dates have no sub-second part
+	lastModified = lastModified.Truncate(time.Second)
+	header := c.Req.Header
+
+	if ifMatch := header.Get("If-Match"); ifMatch != "" {
+		if !etagMatch(ifMatch, etag, false) {
+			return c.preconditionFailed()
+		}
+	} else if t, err := http.ParseTime(header.Get("If-Unmodified-Since")); err == nil && !lastModified.IsZero() {
+		if lastModified.After(t) {
+			return c.preconditionFailed()
+		}
+	}
+
+	if ifNoneMatch := header.Get("If-None-Match"); ifNoneMatch != "" {
+		if !etagMatch(ifNoneMatch, etag, true) {
+			return false
+		}
+		if safe {
+			return c.notModified()
+		}
+		return c.preconditionFailed()
+	}
+	if t, err := http.ParseTime(header.Get("If-Modified-Since")); err == nil && safe && !lastModified.IsZero() {
+		if !lastModified.After(t) {
+			return c.notModified()
+		}
+	}
+	return false
+}
+
+func (c *Context) notModified() bool {
+	// a 304 has no body, the validators and cache headers stay
+	h := c.Writer.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	c.AbortWithStatus(http.StatusNotModified)
+	return true
+}
+
+func (c *Context) preconditionFailed() bool {
+	c.Fail(http.StatusPreconditionFailed, "precondition failed")
+	return true
+}
+
+// etagMatch reports whether etag is in the If-Match / If-None-Match list. The
+// weak comparison ignores the W/ prefix, the strong one never matches weak tags.
+// * matches any current representation, even one without etag.
+func etagMatch(list string, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if !strings.HasPrefix(candidate, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ETag buffers the 200 responses of GET and HEAD requests, tags them with
+// ComputeETag of the body, unless the handler set an ETag itself, and answers
+// a matching If-None-Match with 304. Bodies larger than the engine HTML buffer
+// limit, flushed or hijacked responses are streamed untouched.
+//
+//	r.Group("/api").AppendMid(engine.ETag(true))
+func ETag(weak bool) HandlerFunc {
+	return func(c *Context) {
+		if c.Method != http.MethodGet && c.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		buf := getBuffer()
+		defer putBuffer(buf)
+		w := &etagWriter{
+			ResponseWriter: c.Writer,
+			spill:          spillWriter{w: c.Writer, buf: buf, limit: c.engine.htmlBufferLimit},
+		}
+		c.Writer = w
+		// also restores the writer when a panic goes up to Recovery, the buffered output is dropped
+		defer func() {
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+		if w.spill.streaming || !w.wrote {
+			return
+		}
+
+		header := w.Header()
+		if w.Status() == http.StatusOK {
+			etag := header.Get("ETag")
+			if etag == "" {
+				etag = ComputeETag(buf.Bytes(), weak)
+				header.Set("ETag", etag)
+			}
+			if etagMatch(c.Req.Header.Get("If-None-Match"), etag, true) {
+				header.Del("Content-Type")
+				header.Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				w.ResponseWriter.WriteHeaderNow()
+				return
+			}
+		}
+		if buf.Len() > 0 {
+			header.Set("Content-Length", strconv.Itoa(buf.Len()))
+		}
+		w.ResponseWriter.WriteHeaderNow()
+		w.ResponseWriter.Write(buf.Bytes())
+	}
+}
+
+// etagWriter holds the body back until the ETag middleware computed its tag,
+// status and headers go to the wrapped writer which doesn't send them before
+type etagWriter struct {
+	ResponseWriter
+	spill spillWriter
+	// wrote is the Written state seen by the handlers while buffering
+	wrote bool
+}
+
+func (w *etagWriter) Write(data []byte) (int, error) {
+	w.wrote = true
+	return w.spill.Write(data)
+}
+
+func (w *etagWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *etagWriter) WriteHeaderNow() {
+	if w.spill.streaming {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	w.wrote = true
+}
+
+func (w *etagWriter) Written() bool {
+	return w.wrote || w.ResponseWriter.Written()
+}
+
+func (w *etagWriter) Size() int {
+	if w.spill.streaming {
+		return w.ResponseWriter.Size()
+	}
+	if !w.wrote {
+		return noWritten
+	}
+	return w.spill.buf.Len()
+}
+
+// stream gives up buffering, what was buffered so far is sent first
+func (w *etagWriter) stream() {
+	if w.spill.streaming {
+		return
+	}
+	w.spill.streaming = true
+	w.ResponseWriter.WriteHeaderNow()
+	if w.spill.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.spill.buf.Bytes())
+		w.spill.buf.Reset()
+	}
+}
+
+func (w *etagWriter) Flush() {
+	w.stream()
+	w.ResponseWriter.Flush()
+}
+
+func (w *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.spill.streaming = true
+	return w.ResponseWriter.Hijack()
+}
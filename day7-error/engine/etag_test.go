@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveWith(r *Engine, method string, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestETagMiddleware(t *testing.T) {
+	r := New()
+	r.AppendMid(ETag(true))
+	r.Get("/user", func(c *Context) {
+		c.JSON(http.StatusOK, H{"name": "tom"})
+	})
+	r.Get("/missing", func(c *Context) {
+		c.JSON(http.StatusNotFound, H{"message": "no such user"})
+	})
+
+	w := serveWith(r, "GET", "/user", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) || w.Header().Get("Content-Length") != "15" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	if etag != ComputeETag(w.Body.Bytes(), true) {
+		t.Fatal("the ETag should be computed from the body")
+	}
+
+	w = serveWith(r, "GET", "/user", map[string]string{"If-None-Match": `"other", ` + strings.TrimPrefix(etag, "W/")})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+		t.Fatalf("a matching If-None-Match should give 304, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = serveWith(r, "GET", "/missing", map[string]string{"If-None-Match": "*"})
+	if w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" {
+		t.Fatalf("only 200 responses should be tagged, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestETagMiddlewareStreamsLargeBodies(t *testing.T) {
+	r := New()
+	r.SetHTMLBufferLimit(8)
+	r.AppendMid(ETag(false))
+	r.Get("/large", func(c *Context) {
+		c.Plain(http.StatusOK, strings.Repeat("x", 100))
+	})
+	w := serveWith(r, "GET", "/large", nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 100 || w.Header().Get("ETag") != "" {
+		t.Fatalf("large bodies should be streamed without ETag, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCheckConditions(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	version := ComputeETag([]byte("v2"), false)
+	r := New()
+	r.Get("/doc", func(c *Context) {
+		if c.CheckConditions(version, modified) {
+			return
+		}
+		c.Plain(http.StatusOK, "document")
+	})
+	r.Post("/doc", func(c *Context) {
+		if c.CheckConditions(version, modified) {
+			return
+		}
+		c.Plain(http.StatusOK, "saved")
+	})
+
+	w := serveWith(r, "GET", "/doc", nil)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != version || w.Header().Get("Last-Modified") != "Wed, 01 May 2024 12:00:00 GMT" {
+		t.Fatalf("validators should be set, got %d %v", w.Code, w.Header())
+	}
+	w = serveWith(r, "GET", "/doc", map[string]string{"If-Modified-Since": "Wed, 01 May 2024 12:00:00 GMT"})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("unmodified document should give 304, got %d", w.Code)
+	}
+	// If-None-Match wins over If-Modified-Since
+	w = serveWith(r, "GET", "/doc", map[string]string{"If-None-Match": `"v1"`, "If-Modified-Since": "Wed, 01 May 2024 12:00:00 GMT"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("changed ETag should give 200, got %d", w.Code)
+	}
+
+	w = serveWith(r, "POST", "/doc", map[string]string{"If-Match": ComputeETag([]byte("v1"), false)})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Match should give 412, got %d", w.Code)
+	}
+	w = serveWith(r, "POST", "/doc", map[string]string{"If-Match": "W/" + version})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("If-Match uses the strong comparison, got %d", w.Code)
+	}
+	w = serveWith(r, "POST", "/doc", map[string]string{"If-Unmodified-Since": "Tue, 30 Apr 2024 12:00:00 GMT"})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("document modified since should give 412, got %d", w.Code)
+	}
+	w = serveWith(r, "POST", "/doc", map[string]string{"If-Match": version})
+	if w.Code != http.StatusOK || w.Body.String() != "saved" {
+		t.Fatalf("current If-Match should let the write through, got %d", w.Code)
+	}
+
+	// * matches a resource validated by its modtime only
+	r.Post("/dated", func(c *Context) {
+		if c.CheckConditions("", modified) {
+			return
+		}
+		c.Plain(http.StatusOK, "saved")
+	})
+	w = serveWith(r, "POST", "/dated", map[string]string{"If-Match": "*"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("If-Match: * should match an existing resource, got %d", w.Code)
+	}
+	w = serveWith(r, "POST", "/dated", map[string]string{"If-None-Match": "*"})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("If-None-Match: * should fail for an existing resource, got %d", w.Code)
+	}
+}
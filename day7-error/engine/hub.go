@@ -0,0 +1,447 @@
+// websocket hub: connection registry, named rooms and broadcast
+package engine
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrHubClosed = errors.New("websocket: hub is shut down")
+
+// HubOptions configures a Hub, zero values fall back to sane defaults
+type HubOptions struct {
+	// QueueSize is the number of outgoing messages buffered per connection,
+	// a client whose queue is full is considered too slow and dropped
+	QueueSize int
+	// WriteTimeout bounds every write to a single connection
+	WriteTimeout time.Duration
+	// PingInterval is how often clients are pinged, a client that doesn't
+	// answer within two intervals is disconnected
+	PingInterval time.Duration
+	// Upgrader used by Serve, nil means the default of Context.Upgrade
+	Upgrader *Upgrader
+	// OnMessage is called from the reading goroutine of the client for each data message
+	OnMessage func(cl *Client, messageType int, data []byte)
+	// OnPresence is called when a client joins or leaves a room
+	OnPresence func(room string, id string, joined bool)
+}
+
+// Hub tracks websocket connections and groups them in named rooms
+//
+//	hub := engine.NewHub(engine.HubOptions{
+//	    OnMessage: func(cl *engine.Client, mt int, msg []byte) {
+//	        hub.BroadcastRoom("lobby", mt, msg)
+//	    },
+//	})
+//	r.Get("/chat", func(c *engine.Context) {
+//	    hub.Serve(c, c.Query("user"), "lobby")
+//	})
+type Hub struct {
+	opts HubOptions
+
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+	rooms   map[string]map[*Client]struct{}
+	closed  bool
+
+	wg sync.WaitGroup // one per running Serve
+}
+
+// outgoing message waiting in a client queue
+type hubMessage struct {
+	messageType int
+	data        []byte
+}
+
+// Client is one connection registered in a Hub
+type Client struct {
+	ID   string // application identity, e.g. the authenticated user
+	hub  *Hub
+	conn *Conn
+
+	send  chan hubMessage
+	rooms map[string]struct{} // guarded by hub.mu
+
+	closeOnce sync.Once
+	done      chan struct{}
+	closeCode int
+	closeText string
+	drain     bool // flush queued messages before closing
+}
+
+// NewHub is the constructor of Hub
+func NewHub(opts HubOptions) *Hub {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 64
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 10 * time.Second
+	}
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = 30 * time.Second
+	}
+	if opts.Upgrader == nil {
+		opts.Upgrader = defaultUpgrader
+	}
+	return &Hub{
+		opts:    opts,
+		clients: make(map[*Client]struct{}),
+		rooms:   make(map[string]map[*Client]struct{}),
+	}
+}
+
+// Serve upgrades the request, registers the connection under id, joins the given
+// rooms and blocks until the connection is gone. It is meant to be the last call
+// of a route handler, so the id usually comes from what auth middleware resolved.
+func (h *Hub) Serve(c *Context, id string, rooms ...string) error {
+	h.mu.RLock()
+	closed := h.closed
+	h.mu.RUnlock()
+	if closed {
+		c.Fail(http.StatusServiceUnavailable, ErrHubClosed.Error())
+		return ErrHubClosed
+	}
+
+	conn, err := h.opts.Upgrader.Upgrade(c)
+	if err != nil {
+		return err
+	}
+	cl := &Client{
+		ID:    id,
+		hub:   h,
+		conn:  conn,
+		send:  make(chan hubMessage, h.opts.QueueSize),
+		rooms: make(map[string]struct{}),
+		done:  make(chan struct{}),
+	}
+	joined, ok := h.register(cl, rooms)
+	if !ok {
+		conn.CloseWithCode(CloseGoingAway, "server shutting down")
+		return ErrHubClosed
+	}
+	defer h.unregister(cl)
+	for _, room := range joined {
+		h.notifyPresence(room, cl.ID, true)
+	}
+
+	writerDone := make(chan struct{})
+	go func() {
+		cl.writeLoop()
+		close(writerDone)
+	}()
+	cl.readLoop()
+	// reader is gone: make sure the writer stops too, then wait for it
+	cl.close(CloseNormalClosure, "", false)
+	<-writerDone
+	return nil
+}
+
+// register adds cl and its initial rooms at once, a client counted by Count is
+// already in Presence; the joined rooms are returned for the presence notifications
+func (h *Hub) register(cl *Client, rooms []string) ([]string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, false
+	}
+	h.clients[cl] = struct{}{}
+	h.wg.Add(1)
+	joined := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		if h.joinLocked(cl, room) {
+			joined = append(joined, room)
+		}
+	}
+	return joined, true
+}
+
+func (h *Hub) unregister(cl *Client) {
+	h.mu.Lock()
+	delete(h.clients, cl)
+	left := make([]string, 0, len(cl.rooms))
+	for room := range cl.rooms {
+		h.leaveLocked(cl, room)
+		left = append(left, room)
+	}
+	h.mu.Unlock()
+	for _, room := range left {
+		h.notifyPresence(room, cl.ID, false)
+	}
+	h.wg.Done()
+}
+
+// joinLocked must be called with h.mu held, it returns false if cl already is in room
+func (h *Hub) joinLocked(cl *Client, room string) bool {
+	if _, ok := cl.rooms[room]; ok {
+		return false
+	}
+	cl.rooms[room] = struct{}{}
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Client]struct{})
+	}
+	h.rooms[room][cl] = struct{}{}
+	return true
+}
+
+// leaveLocked must be called with h.mu held
+func (h *Hub) leaveLocked(cl *Client, room string) {
+	delete(cl.rooms, room)
+	members := h.rooms[room]
+	delete(members, cl)
+	if len(members) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+func (h *Hub) notifyPresence(room string, id string, joined bool) {
+	if h.opts.OnPresence != nil {
+		h.opts.OnPresence(room, id, joined)
+	}
+}
+
+// Broadcast queues a message for every connection of the hub
+func (h *Hub) Broadcast(messageType int, data []byte) {
+	h.mu.RLock()
+	targets := make([]*Client, 0, len(h.clients))
+	for cl := range h.clients {
+		targets = append(targets, cl)
+	}
+	h.mu.RUnlock()
+	for _, cl := range targets {
+		cl.Send(messageType, data)
+	}
+}
+
+// BroadcastRoom queues a message for every connection in room
+func (h *Hub) BroadcastRoom(room string, messageType int, data []byte) {
+	for _, cl := range h.members(room) {
+		cl.Send(messageType, data)
+	}
+}
+
+// SendTo queues a message for every connection registered with id,
+// it returns the number of connections the message was queued for
+func (h *Hub) SendTo(id string, messageType int, data []byte) int {
+	h.mu.RLock()
+	targets := make([]*Client, 0)
+	for cl := range h.clients {
+		if cl.ID == id {
+			targets = append(targets, cl)
+		}
+	}
+	h.mu.RUnlock()
+	sent := 0
+	for _, cl := range targets {
+		if cl.Send(messageType, data) {
+			sent++
+		}
+	}
+	return sent
+}
+
+func (h *Hub) members(room string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	members := make([]*Client, 0, len(h.rooms[room]))
+	for cl := range h.rooms[room] {
+		members = append(members, cl)
+	}
+	return members
+}
+
+// Presence returns the sorted, de-duplicated ids of the connections in room
+func (h *Hub) Presence(room string) []string {
+	seen := make(map[string]struct{})
+	ids := make([]string, 0)
+	for _, cl := range h.members(room) {
+		if _, ok := seen[cl.ID]; !ok {
+			seen[cl.ID] = struct{}{}
+			ids = append(ids, cl.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Rooms returns the sorted names of the rooms with at least one member
+func (h *Hub) Rooms() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	rooms := make([]string, 0, len(h.rooms))
+	for room := range h.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// Count returns the number of registered connections
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// Shutdown stops accepting connections, flushes the queues, closes every
+// connection with CloseGoingAway and waits for them to finish or ctx to expire
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closed = true
+	clients := make([]*Client, 0, len(h.clients))
+	for cl := range h.clients {
+		clients = append(clients, cl)
+	}
+	h.mu.Unlock()
+
+	for _, cl := range clients {
+		cl.close(CloseGoingAway, "server shutting down", true)
+	}
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Join adds the client to room
+func (cl *Client) Join(room string) {
+	h := cl.hub
+	h.mu.Lock()
+	if _, ok := h.clients[cl]; !ok {
+		// already unregistered
+		h.mu.Unlock()
+		return
+	}
+	joined := h.joinLocked(cl, room)
+	h.mu.Unlock()
+	if joined {
+		h.notifyPresence(room, cl.ID, true)
+	}
+}
+
+// Leave removes the client from room
+func (cl *Client) Leave(room string) {
+	h := cl.hub
+	h.mu.Lock()
+	if _, ok := cl.rooms[room]; !ok {
+		h.mu.Unlock()
+		return
+	}
+	h.leaveLocked(cl, room)
+	h.mu.Unlock()
+	h.notifyPresence(room, cl.ID, false)
+}
+
+// Send queues a message without blocking. When the queue is full the client
+// is dropped with ClosePolicyViolation, so one slow reader can't stall a broadcast.
+func (cl *Client) Send(messageType int, data []byte) bool {
+	select {
+	case <-cl.done:
+		return false
+	default:
+	}
+	select {
+	case cl.send <- hubMessage{messageType: messageType, data: data}:
+		return true
+	case <-cl.done:
+		return false
+	default:
+		cl.close(ClosePolicyViolation, "slow consumer", false)
+		return false
+	}
+}
+
+// Close disconnects the client with a normal closure
+func (cl *Client) Close() {
+	cl.close(CloseNormalClosure, "", true)
+}
+
+// close signals the write loop to send a close frame and close the connection,
+// only the first call has an effect
+func (cl *Client) close(code int, text string, drain bool) {
+	cl.closeOnce.Do(func() {
+		cl.closeCode = code
+		cl.closeText = text
+		cl.drain = drain
+		close(cl.done)
+	})
+}
+
+// readLoop dispatches incoming messages until the connection fails
+func (cl *Client) readLoop() {
+	pongWait := 2 * cl.hub.opts.PingInterval
+	cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+	cl.conn.SetPongHandler(func(string) {
+		cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		mt, data, err := cl.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+		if cl.hub.opts.OnMessage != nil {
+			cl.hub.opts.OnMessage(cl, mt, data)
+		}
+	}
+}
+
+// writeLoop is the only goroutine writing data messages to the connection
+func (cl *Client) writeLoop() {
+	ticker := time.NewTicker(cl.hub.opts.PingInterval)
+	defer ticker.Stop()
+	defer cl.conn.conn.Close()
+	for {
+		select {
+		case msg := <-cl.send:
+			if err := cl.write(msg); err != nil {
+				cl.close(CloseAbnormalClosure, "", false)
+				return
+			}
+		case <-ticker.C:
+			deadline := time.Now().Add(cl.hub.opts.WriteTimeout)
+			if err := cl.conn.WriteControl(PingMessage, nil, deadline); err != nil {
+				cl.close(CloseAbnormalClosure, "", false)
+				return
+			}
+		case <-cl.done:
+			if cl.drain {
+				cl.flush()
+			}
+			if cl.closeCode != CloseAbnormalClosure {
+				deadline := time.Now().Add(cl.hub.opts.WriteTimeout)
+				cl.conn.WriteControl(CloseMessage, formatClose(cl.closeCode, cl.closeText), deadline)
+			}
+			return
+		}
+	}
+}
+
+// flush writes the messages still queued, without waiting for new ones
+func (cl *Client) flush() {
+	for {
+		select {
+		case msg := <-cl.send:
+			if err := cl.write(msg); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (cl *Client) write(msg hubMessage) error {
+	cl.conn.SetWriteDeadline(time.Now().Add(cl.hub.opts.WriteTimeout))
+	return cl.conn.WriteMessage(msg.messageType, msg.data)
+}
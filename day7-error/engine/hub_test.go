@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newHubServer(hub *Hub) *httptest.Server {
+	r := New()
+	r.Get("/chat", func(c *Context) {
+		hub.Serve(c, c.Query("user"), "lobby")
+	})
+	return httptest.NewServer(r)
+}
+
+// waitFor polls cond, hub registration happens asynchronously to the handshake
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met in time")
+}
+
+func TestHubBroadcastRoom(t *testing.T) {
+	var hub *Hub
+	hub = NewHub(HubOptions{
+		OnMessage: func(cl *Client, mt int, data []byte) {
+			hub.BroadcastRoom("lobby", mt, append([]byte(cl.ID+": "), data...))
+		},
+	})
+	server := newHubServer(hub)
+	defer server.Close()
+
+	alice, _ := dialWebSocket(t, server, "/chat?user=alice", nil)
+	bob, _ := dialWebSocket(t, server, "/chat?user=bob", nil)
+	defer alice.Close()
+	defer bob.Close()
+	waitFor(t, func() bool { return len(hub.Presence("lobby")) == 2 })
+
+	if !reflect.DeepEqual(hub.Presence("lobby"), []string{"alice", "bob"}) || hub.Count() != 2 {
+		t.Fatalf("unexpected presence %v", hub.Presence("lobby"))
+	}
+
+	alice.WriteMessage(TextMessage, []byte("hi"))
+	for _, ws := range []*Conn{alice, bob} {
+		_, msg, err := ws.ReadMessage()
+		if err != nil || string(msg) != "alice: hi" {
+			t.Fatalf("unexpected broadcast %q %v", msg, err)
+		}
+	}
+
+	bob.Close()
+	waitFor(t, func() bool { return hub.Count() == 1 })
+	if !reflect.DeepEqual(hub.Presence("lobby"), []string{"alice"}) {
+		t.Fatalf("bob should have left the lobby, got %v", hub.Presence("lobby"))
+	}
+}
+
+func TestHubDropSlowClient(t *testing.T) {
+	hub := NewHub(HubOptions{QueueSize: 1})
+	cl := &Client{hub: hub, send: make(chan hubMessage, 1), done: make(chan struct{})}
+	if !cl.Send(TextMessage, []byte("1")) {
+		t.Fatal("first message should be queued")
+	}
+	if cl.Send(TextMessage, []byte("2")) {
+		t.Fatal("full queue should drop the client")
+	}
+	select {
+	case <-cl.done:
+	default:
+		t.Fatal("dropped client should be closed")
+	}
+	if cl.closeCode != ClosePolicyViolation {
+		t.Fatal("slow client should be closed with policy violation")
+	}
+}
+
+func TestHubShutdown(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	server := newHubServer(hub)
+	defer server.Close()
+
+	ws, _ := dialWebSocket(t, server, "/chat?user=alice", nil)
+	defer ws.Close()
+	waitFor(t, func() bool { return hub.Count() == 1 })
+	hub.BroadcastRoom("lobby", TextMessage, []byte("bye"))
+
+	go func() {
+		// answer the close frame so the server side read loop ends
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if hub.Count() != 0 {
+		t.Fatal("all clients should be gone after shutdown")
+	}
+
+	late, resp := dialWebSocket(t, server, "/chat?user=bob", nil)
+	if late != nil || resp.StatusCode != 503 {
+		t.Fatal("hub should refuse connections after shutdown")
+	}
+}
@@ -0,0 +1,320 @@
+// on-the-fly image resizing for static routes, /img/photo.jpg?w=320&h=200&fit=cover
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultImageQuality = 85
+	// maxImagePixels guards against decompression bombs, ~52M pixels, an 8K
+	// picture (7680x4320) is ~33M
+	maxImagePixels = 50 << 20
+)
+
+// ImageSize is an allowed output size, a 0 dimension keeps the aspect ratio
+type ImageSize struct {
+	Width  int
+	Height int
+}
+
+// ImageOptions configures StaticImages
+type ImageOptions struct {
+	// Sizes is the whitelist of w/h query values, other sizes are a 400 so
+	// clients can't fill the cache with arbitrary variants
+	Sizes []ImageSize
+	// CacheDir keeps the transformed variants, default $TMPDIR/engine-images,
+	// routes sharing it get distinct variants
+	CacheDir string
+	// Quality of the JPEG variants, default 85
+	Quality int
+}
+
+// StaticImages works like StaticFS, JPEG, PNG and GIF files can also be
+// requested resized with the w and h query parameters and one of the fits:
+//
+//	contain  fit inside w x h keeping the aspect ratio (default)
+//	cover    fill w x h keeping the aspect ratio, the overflow is cropped around the center
+//	fill     stretch to w x h
+//
+// r.StaticImages("/img", http.Dir("./photos"), ImageOptions{Sizes: []ImageSize{{320, 200}}})
+// then serves /img/cat.jpg?w=320&h=200&fit=cover. Variants are computed once and
+// kept in CacheDir, a changed source gets new variants. GIFs lose their animation.
+func (group *RouterGroup) StaticImages(relativePath string, fs http.FileSystem, opts ImageOptions) error {
+	checkStaticPath(relativePath)
+	if opts.CacheDir == "" {
+		opts.CacheDir = filepath.Join(os.TempDir(), "engine-images")
+	}
+	if opts.Quality <= 0 {
+		opts.Quality = defaultImageQuality
+	}
+	if err := os.MkdirAll(opts.CacheDir, 0700); err != nil {
+		return err
+	}
+	// the route is part of the variant key, e.g. /img/logo.png and /avatars/logo.png
+	prefix := path.Join(group.prefix, relativePath)
+	static := group.createStaticHandler(relativePath, fs)
+	handler := func(c *Context) {
+		if c.Query("w") == "" && c.Query("h") == "" && c.Query("fit") == "" {
+			static(c)
+			return
+		}
+		serveImage(c, fs, prefix, opts, static)
+	}
+	group.Get(path.Join(relativePath, "/*filepath"), handler)
+	return nil
+}
+
+func serveImage(c *Context, fs http.FileSystem, prefix string, opts ImageOptions, static HandlerFunc) {
+	file := c.Param("filepath")
+	if !validStaticPath(file) {
+		static(c)
+		return
+	}
+	format := imageFormat(file)
+	if format == "" {
+		c.Fail(http.StatusBadRequest, "only JPEG, PNG and GIF images can be resized")
+		return
+	}
+	size, ok := allowedImageSize(c.Query("w"), c.Query("h"), opts.Sizes)
+	if !ok {
+		c.Fail(http.StatusBadRequest, "image size not allowed")
+		return
+	}
+	fit := c.DefaultQuery("fit", "contain")
+	if fit != "contain" && fit != "cover" && fit != "fill" {
+		c.Fail(http.StatusBadRequest, "fit must be contain, cover or fill")
+		return
+	}
+
+	name := path.Join("/", file)
+	f, err := fs.Open(name)
+	if err != nil {
+		c.notFound()
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		c.notFound()
+		return
+	}
+
+	// the source modtime and size are part of the key, an updated image gets new variants
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%d|%dx%d|%s|%d",
+		prefix, name, stat.ModTime().UnixNano(), stat.Size(), size.Width, size.Height, fit, opts.Quality)))
+	cached := filepath.Join(opts.CacheDir, hex.EncodeToString(sum[:16])+path.Ext(file))
+	if c.serveFile(http.Dir(opts.CacheDir), "/"+filepath.Base(cached)) {
+		return
+	}
+
+	config, _, err := image.DecodeConfig(f)
+	if err == nil && config.Width*config.Height > maxImagePixels {
+		err = errors.New("image too large")
+	}
+	var src image.Image
+	if err == nil {
+		if _, err = f.Seek(0, io.SeekStart); err == nil {
+			src, _, err = image.Decode(f)
+		}
+	}
+	if err != nil {
+		c.Error(fmt.Errorf("image %s: %w", name, err))
+		c.Fail(http.StatusInternalServerError, "invalid image")
+		return
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := encodeImage(buf, format, resizeImage(src, size, fit), opts.Quality); err != nil {
+		c.Error(err)
+		c.Fail(http.StatusInternalServerError, "invalid image")
+		return
+	}
+	// the variant is as old as its source, Last-Modified doesn't change once cached
+	if err := writeFileAtomic(cached, buf.Bytes(), stat.ModTime()); err != nil {
+		// the variant is still served, it will be computed again next time
+		c.Error(err)
+	}
+	http.ServeContent(c.Writer, c.Req, stat.Name(), stat.ModTime(), bytes.NewReader(buf.Bytes()))
+}
+
+// imageFormat returns the format of the file extension, "" if it can't be resized
+func imageFormat(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".png":
+		return "png"
+	case ".gif":
+		return "gif"
+	}
+	return ""
+}
+
+func allowedImageSize(w string, h string, sizes []ImageSize) (ImageSize, bool) {
+	var size ImageSize
+	var err error
+	if w != "" {
+		if size.Width, err = strconv.Atoi(w); err != nil {
+			return size, false
+		}
+	}
+	if h != "" {
+		if size.Height, err = strconv.Atoi(h); err != nil {
+			return size, false
+		}
+	}
+	if size.Width <= 0 && size.Height <= 0 {
+		return size, false
+	}
+	for _, allowed := range sizes {
+		if allowed == size {
+			return size, true
+		}
+	}
+	return size, false
+}
+
+// resizeImage scales src to size following fit, see StaticImages
+func resizeImage(src image.Image, size ImageSize, fit string) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	w, h := size.Width, size.Height
+	switch {
+	case w == 0:
+		w = maxInt(1, sw*h/sh)
+	case h == 0:
+		h = maxInt(1, sh*w/sw)
+	case fit == "contain":
+		if sw*h > sh*w {
+			h = maxInt(1, sh*w/sw)
+		} else {
+			w = maxInt(1, sw*h/sh)
+		}
+	case fit == "cover":
+		// crop the source to the aspect ratio of w x h around its center
+		crop := bounds
+		if sw*h > sh*w {
+			cw := maxInt(1, sh*w/h)
+			crop.Min.X += (sw - cw) / 2
+			crop.Max.X = crop.Min.X + cw
+		} else {
+			ch := maxInt(1, sw*h/w)
+			crop.Min.Y += (sh - ch) / 2
+			crop.Max.Y = crop.Min.Y + ch
+		}
+		bounds = crop
+	}
+	return scaleBox(src, bounds, w, h)
+}
+
+// scaleBox scales the rect r of src to w x h, every destination pixel is the
+// average of the source pixels it covers (nearest neighbour when enlarging).
+// The source rows are converted to RGBA one band at a time, a large source is
+// never copied whole.
+func scaleBox(src image.Image, r image.Rectangle, w int, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := r.Dx(), r.Dy()
+	var band, buf *image.RGBA
+	for y := 0; y < h; y++ {
+		y0 := r.Min.Y + y*sh/h
+		y1 := maxInt(y0+1, r.Min.Y+(y+1)*sh/h)
+		rows := image.Rect(r.Min.X, y0, r.Max.X, y1)
+		if rgba, ok := src.(*image.RGBA); ok {
+			band = rgba.SubImage(rows).(*image.RGBA)
+		} else if band == nil || band.Rect != rows {
+			buf = reuseRGBA(buf, rows)
+			draw.Draw(buf, rows, src, rows.Min, draw.Src)
+			band = buf
+		}
+		for x := 0; x < w; x++ {
+			x0 := r.Min.X + x*sw/w
+			x1 := maxInt(x0+1, r.Min.X+(x+1)*sw/w)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := band.Pix[band.PixOffset(x0, sy):band.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			i := dst.PixOffset(x, y)
+			for k := 0; k < 4; k++ {
+				dst.Pix[i+k] = uint8(sum[k] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// reuseRGBA returns an RGBA image of rect r backed by the pixels of img when
+// they are large enough
+func reuseRGBA(img *image.RGBA, r image.Rectangle) *image.RGBA {
+	n := 4 * r.Dx() * r.Dy()
+	if img == nil || cap(img.Pix) < n {
+		return image.NewRGBA(r)
+	}
+	return &image.RGBA{Pix: img.Pix[:n], Stride: 4 * r.Dx(), Rect: r}
+}
+
+func encodeImage(buf *bytes.Buffer, format string, img image.Image, quality int) error {
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
+	case "png":
+		return png.Encode(buf, img)
+	default:
+		return gif.Encode(buf, img, nil)
+	}
+}
+
+// writeFileAtomic goes through a temp file so concurrent requests of the same
+// variant never serve a truncated file
+func writeFileAtomic(name string, data []byte, modTime time.Time) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "tmp_image_")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), modTime, modTime); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
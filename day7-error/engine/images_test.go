@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestImages writes a 100x50 picture, red on the left half and blue on the right
+func newTestImages(t *testing.T) string {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 100; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 50 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	dir := t.TempDir()
+	for name, encode := range map[string]func(*bytes.Buffer) error{
+		"photo.png": func(buf *bytes.Buffer) error { return png.Encode(buf, img) },
+		"photo.jpg": func(buf *bytes.Buffer) error { return jpeg.Encode(buf, img, nil) },
+		"photo.gif": func(buf *bytes.Buffer) error { return gif.Encode(buf, img, nil) },
+	} {
+		var buf bytes.Buffer
+		if err := encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("text"), 0600)
+	return dir
+}
+
+func decodeResponse(t *testing.T, body []byte) image.Image {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("invalid image: %v", err)
+	}
+	return img
+}
+
+func TestStaticImages(t *testing.T) {
+	cache := t.TempDir()
+	r := New()
+	err := r.StaticImages("/img", http.Dir(newTestImages(t)), ImageOptions{
+		Sizes:    []ImageSize{{40, 40}, {50, 0}},
+		CacheDir: cache,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		w, h   int
+	}{
+		{"/img/photo.png?w=40&h=40&fit=cover", 40, 40},
+		{"/img/photo.png?w=40&h=40", 40, 20},
+		{"/img/photo.jpg?w=40&h=40&fit=fill", 40, 40},
+		{"/img/photo.gif?w=50", 50, 25},
+	}
+	for _, tt := range tests {
+		w := serveWith(r, "GET", tt.target, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d %q", tt.target, w.Code, w.Body.String())
+		}
+		if b := decodeResponse(t, w.Body.Bytes()).Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Fatalf("%s: got %dx%d, want %dx%d", tt.target, b.Dx(), b.Dy(), tt.w, tt.h)
+		}
+	}
+
+	// cover keeps the center, both colors stay visible
+	w := serveWith(r, "GET", "/img/photo.png?w=40&h=40&fit=cover", nil)
+	img := decodeResponse(t, w.Body.Bytes())
+	if red, _, _, _ := img.At(0, 20).RGBA(); red == 0 {
+		t.Fatal("left side of the cover crop should be red")
+	}
+	if _, _, blue, _ := img.At(39, 20).RGBA(); blue == 0 {
+		t.Fatal("right side of the cover crop should be blue")
+	}
+
+	files, _ := os.ReadDir(cache)
+	if len(files) != 4 {
+		t.Fatalf("every variant should be cached once, got %d files", len(files))
+	}
+}
+
+func TestStaticImagesRejects(t *testing.T) {
+	r := New()
+	dir := newTestImages(t)
+	if err := r.StaticImages("/img", http.Dir(dir), ImageOptions{Sizes: []ImageSize{{40, 40}}, CacheDir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := os.ReadFile(filepath.Join(dir, "photo.png"))
+	if w := serveWith(r, "GET", "/img/photo.png", nil); !bytes.Equal(w.Body.Bytes(), original) {
+		t.Fatal("without parameters the original file should be served")
+	}
+
+	tests := []struct {
+		target string
+		code   int
+	}{
+		{"/img/photo.png?w=41&h=40", http.StatusBadRequest},
+		{"/img/photo.png?w=abc", http.StatusBadRequest},
+		{"/img/photo.png?w=40&h=40&fit=zoom", http.StatusBadRequest},
+		{"/img/notes.txt?w=40&h=40", http.StatusBadRequest},
+		{"/img/missing.png?w=40&h=40", http.StatusNotFound},
+		{"/img/../photo.png?w=40&h=40", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serveWith(r, "GET", tt.target, nil); w.Code != tt.code {
+			t.Fatalf("%s: got %d, want %d", tt.target, w.Code, tt.code)
+		}
+	}
+}
+
+func TestStaticImagesSharedCache(t *testing.T) {
+	cache := t.TempDir()
+	dir := newTestImages(t)
+	r := New()
+	opts := ImageOptions{Sizes: []ImageSize{{40, 40}}, CacheDir: cache}
+	for _, prefix := range []string{"/img", "/avatars"} {
+		if err := r.StaticImages(prefix, http.Dir(dir), opts); err != nil {
+			t.Fatal(err)
+		}
+		if w := serveWith(r, "GET", prefix+"/photo.png?w=40&h=40", nil); w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", prefix, w.Code)
+		}
+	}
+	// the same file name under two routes may be two different pictures
+	if files, _ := os.ReadDir(cache); len(files) != 2 {
+		t.Fatalf("routes sharing a cache dir should not share variants, got %d files", len(files))
+	}
+}
+
+func TestScaleBoxSources(t *testing.T) {
+	// the same picture as RGBA and as YCbCr scales to the same colors
+	rgba := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	draw.Draw(rgba, image.Rect(0, 0, 32, 32), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(rgba, image.Rect(32, 0, 64, 32), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: 100})
+	ycbcr, _ := jpeg.Decode(&buf)
+
+	crop := image.Rect(16, 0, 48, 32)
+	for _, src := range []image.Image{rgba, ycbcr} {
+		dst := scaleBox(src, crop, 4, 4)
+		if r, _, _, _ := dst.At(0, 0).RGBA(); r < 0xf000 {
+			t.Fatalf("%T: left of the crop should be white", src)
+		}
+		if r, _, _, _ := dst.At(3, 3).RGBA(); r > 0x0fff {
+			t.Fatalf("%T: right of the crop should be black", src)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// per-page template sets: every page is parsed with the layout and the partials
+package engine
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LayoutOptions are the globs of LoadHTMLLayouts, relative to its root
+type LayoutOptions struct {
+	// Layout is the file every page is rendered through, default "layouts/base.tmpl"
+	Layout string
+	// Pages are parsed each in their own set, default "pages/*.tmpl"
+	Pages string
+	// Partials are shared by every page, default "partials/*.tmpl"
+	Partials string
+}
+
+// LoadHTMLLayouts parses every page with its own copy of the layout and the
+// partials, so all pages can define the same blocks. A page is rendered by
+// its path relative to root without extension:
+//
+//	templates/layouts/base.tmpl   <html>{{template "nav" .}}{{block "content" .}}{{end}}</html>
+//	templates/partials/nav.tmpl   {{define "nav"}}<nav>...</nav>{{end}}
+//	templates/pages/user.tmpl     {{define "content"}}<p>{{.Name}}</p>{{end}}
+//
+//	r.LoadHTMLLayouts("templates", engine.LayoutOptions{})
+//	c.HTML(http.StatusOK, "pages/user", user)
+func (engine *Engine) LoadHTMLLayouts(root string, opts LayoutOptions) {
+	if opts.Layout == "" {
+		opts.Layout = "layouts/base.tmpl"
+	}
+	if opts.Pages == "" {
+		opts.Pages = "pages/*.tmpl"
+	}
+	if opts.Partials == "" {
+		opts.Partials = "partials/*.tmpl"
+	}
+	layout := filepath.Join(root, opts.Layout)
+	pages := filepath.Join(root, opts.Pages)
+	partials := filepath.Join(root, opts.Partials)
+	parse := func() (htmlExecutor, error) {
+		return parsePages(root, layout, pages, partials, engine.templateFuncs())
+	}
+	engine.loadHTML(parse, func() (string, error) {
+		return globSignature(layout, pages, partials)
+	})
+}
+
+// pageTemplates holds one set per page
+type pageTemplates struct {
+	// layout is the name of the template executed, the base name of the layout file
+	layout string
+	pages  map[string]*template.Template
+}
+
+func parsePages(root string, layout string, pages string, partials string, funcs template.FuncMap) (*pageTemplates, error) {
+	partialFiles, err := filepath.Glob(partials)
+	if err != nil {
+		return nil, err
+	}
+	pageFiles, err := filepath.Glob(pages)
+	if err != nil {
+		return nil, err
+	}
+	if len(pageFiles) == 0 {
+		return nil, fmt.Errorf("html/template: pattern matches no files: %#q", pages)
+	}
+	base, err := template.New(filepath.Base(layout)).Funcs(funcs).ParseFiles(append([]string{layout}, partialFiles...)...)
+	if err != nil {
+		return nil, err
+	}
+	set := &pageTemplates{
+		layout: filepath.Base(layout),
+		pages:  make(map[string]*template.Template, len(pageFiles)),
+	}
+	for _, file := range pageFiles {
+		// the clone is cheaper than parsing the layout and the partials again
+		page, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if page, err = page.ParseFiles(file); err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		set.pages[strings.TrimSuffix(rel, path.Ext(rel))] = page
+	}
+	return set, nil
+}
+
+// ExecuteTemplate renders the page name ("pages/user", "pages/user.tmpl" works too) through the layout
+func (set *pageTemplates) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	page, ok := set.pages[name]
+	if !ok {
+		page, ok = set.pages[strings.TrimSuffix(name, path.Ext(name))]
+	}
+	if !ok {
+		return fmt.Errorf("html/template: no page %q", name)
+	}
+	return page.ExecuteTemplate(w, set.layout, data)
+}
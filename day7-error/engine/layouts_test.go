@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newLayoutDir(t *testing.T) string {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "layouts/base.tmpl", `<title>{{block "title" .}}site{{end}}</title>{{template "nav" .}}{{block "content" .}}{{end}}`)
+	writeTemplate(t, dir, "partials/nav.tmpl", `{{define "nav"}}<nav>{{upper "menu"}}</nav>{{end}}`)
+	writeTemplate(t, dir, "pages/user.tmpl", `{{define "title"}}user{{end}}{{define "content"}}<p>{{.}}</p>{{end}}`)
+	writeTemplate(t, dir, "pages/about.tmpl", `{{define "content"}}<p>about</p>{{end}}`)
+	return dir
+}
+
+func TestLoadHTMLLayouts(t *testing.T) {
+	r := New()
+	r.SetFuncMap(template.FuncMap{"upper": strings.ToUpper})
+	r.LoadHTMLLayouts(newLayoutDir(t), LayoutOptions{})
+	r.Get("/user", func(c *Context) {
+		c.HTML(http.StatusOK, "pages/user", "tom")
+	})
+	r.Get("/about", func(c *Context) {
+		c.HTML(http.StatusOK, "pages/about.tmpl", nil)
+	})
+	r.Get("/missing", func(c *Context) {
+		c.HTML(http.StatusOK, "pages/missing", nil)
+	})
+
+	// both pages define content without colliding
+	if w := serveWith(r, "GET", "/user", nil); w.Body.String() != "<title>user</title><nav>MENU</nav><p>tom</p>" {
+		t.Fatalf("unexpected page %q", w.Body.String())
+	}
+	if w := serveWith(r, "GET", "/about", nil); w.Body.String() != "<title>site</title><nav>MENU</nav><p>about</p>" {
+		t.Fatalf("unexpected page %q", w.Body.String())
+	}
+	if w := serveWith(r, "GET", "/missing", nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("unknown page should give 500, got %d", w.Code)
+	}
+}
+
+func TestLoadHTMLLayoutsReload(t *testing.T) {
+	dir := newLayoutDir(t)
+	r := New()
+	r.SetDebug(true)
+	r.SetFuncMap(template.FuncMap{"upper": strings.ToUpper})
+	r.LoadHTMLLayouts(dir, LayoutOptions{})
+	r.Get("/about", func(c *Context) {
+		c.HTML(http.StatusOK, "pages/about", nil)
+	})
+
+	writeTemplate(t, dir, "layouts/base.tmpl", `<main>{{block "content" .}}{{end}}</main>`)
+	if w := serveWith(r, "GET", "/about", nil); w.Body.String() != "<main><p>about</p></main>" {
+		t.Fatalf("edited layout should be reloaded, got %q", w.Body.String())
+	}
+	writeTemplate(t, dir, "partials/nav.tmpl", `{{define "nav"}}`)
+	if w := serveWith(r, "GET", "/about", nil); w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "nav.tmpl") {
+		t.Fatalf("broken partial should be shown, got %d %q", w.Code, w.Body.String())
+	}
+}
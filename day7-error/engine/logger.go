@@ -1,10 +1,19 @@
 package engine
 
 import (
+	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
+// well known Keys, Logger and Recovery append them to their output when a
+// previous middleware Set them, e.g. c.Set(RequestIDKey, uuid)
+const (
+	RequestIDKey = "requestID"
+	UserIDKey    = "userID"
+)
+
 func Logger() HandlerFunc {
 	return func(c *Context) {
 		// Start timer
@@ -12,6 +21,19 @@ func Logger() HandlerFunc {
 		// Process request
 		c.Next()
 		// Calculate resolution time
-		log.Printf("[%d] %s in %v", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		log.Printf("[%d] %s in %v%s", c.Writer.Status(), c.Req.RequestURI, time.Since(t), logFields(c))
+	}
+}
+
+// logFields formats the client IP and the well known Keys present in c as " key=value ..."
+func logFields(c *Context) string {
+	var str strings.Builder
+	str.WriteString(" client_ip=" + c.ClientIP())
+	if id, ok := c.Get(RequestIDKey); ok {
+		str.WriteString(fmt.Sprintf(" request_id=%v", id))
+	}
+	if id, ok := c.Get(UserIDKey); ok {
+		str.WriteString(fmt.Sprintf(" user_id=%v", id))
 	}
+	return str.String()
 }
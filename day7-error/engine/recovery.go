@@ -13,8 +13,8 @@ func Recovery() HandlerFunc {
 	return func(c *Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				message := fmt.Sprintf("%s", err)
-				log.Printf("%s\n\n", trace(message))
+				logPanic(c, err)
+				c.Error(fmt.Errorf("panic: %s", err))
 				c.Fail(http.StatusInternalServerError, "Internal Server Error")
 			}
 		}()
@@ -24,11 +24,39 @@ func Recovery() HandlerFunc {
 	}
 }
 
+// Go runs fn in a new goroutine with a read-only copy of c, a panic is
+// recovered and logged like Recovery does instead of crashing the server.
+// The copy isn't canceled when the request ends, see Copy.
+//
+//	r.Get("/signup", func(c *engine.Context) {
+//	    c.Go(func(c *engine.Context) {
+//	        sendWelcomeMail(c.GetString(engine.UserIDKey))
+//	    })
+//	    c.Plain(http.StatusOK, "ok")
+//	})
+func (c *Context) Go(fn func(c *Context)) {
+	cp := c.Copy()
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logPanic(cp, err)
+			}
+		}()
+		fn(cp)
+	}()
+}
+
+// logPanic must be called directly by the deferred func that recovered
+func logPanic(c *Context, err interface{}) {
+	message := fmt.Sprintf("%s%s", err, logFields(c))
+	log.Printf("%s\n\n", trace(message))
+}
+
 // print stack trace for debug
 func trace(message string) string {
 	var pcs [32]uintptr
-	// skip first 3 caller, 1st is caller itself, 2st is trace, 3rd is defer that calls trace
-	n := runtime.Callers(3, pcs[:])
+	// skip first 4 caller, 1st is caller itself, 2st is trace, 3rd is logPanic, 4th is defer that calls logPanic
+	n := runtime.Callers(4, pcs[:])
 
 	var str strings.Builder
 	str.WriteString(message + "\nTraceback:")
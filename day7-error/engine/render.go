@@ -0,0 +1,100 @@
+// buffered rendering: a response is built in memory and committed at once
+package engine
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"io"
+	"sync"
+	texttemplate "text/template"
+)
+
+const (
+	// defaultHTMLBufferLimit is the size above which HTML pages are streamed
+	defaultHTMLBufferLimit = 1 << 20
+	// buffers grown above maxPooledBuffer are left to the GC instead of being pooled
+	maxPooledBuffer = 64 << 10
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// spillWriter buffers the output until limit bytes, past that it commits the
+// status and headers and streams everything to the client
+type spillWriter struct {
+	w         ResponseWriter
+	buf       *bytes.Buffer
+	limit     int
+	streaming bool
+}
+
+func (sw *spillWriter) Write(p []byte) (int, error) {
+	if sw.streaming {
+		return sw.w.Write(p)
+	}
+	if sw.buf.Len()+len(p) <= sw.limit {
+		return sw.buf.Write(p)
+	}
+	sw.streaming = true
+	if _, err := sw.w.Write(sw.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	sw.buf.Reset()
+	return sw.w.Write(p)
+}
+
+// HTMLRender renders the templates of c.HTML, set with Engine.SetHTMLRender to
+// plug in another template engine. Render writes into a buffer, a returned
+// error becomes a clean 500 as long as the page fits in the HTML buffer limit.
+type HTMLRender interface {
+	Render(w io.Writer, name string, data interface{}) error
+}
+
+// htmlExecutor renders the template name of a set, the templates of
+// html/template and text/template are ones
+type htmlExecutor interface {
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+// executorRender adapts a template set to HTMLRender
+type executorRender struct {
+	htmlExecutor
+}
+
+func (r executorRender) Render(w io.Writer, name string, data interface{}) error {
+	return r.ExecuteTemplate(w, name, data)
+}
+
+// HTMLTemplate returns the HTMLRender of an html/template set built by hand
+func HTMLTemplate(tmpl *htmltemplate.Template) HTMLRender {
+	return executorRender{tmpl}
+}
+
+// TextTemplate returns the HTMLRender of a text/template set. Nothing is escaped,
+// only use it for trusted data or output that isn't HTML.
+func TextTemplate(tmpl *texttemplate.Template) HTMLRender {
+	return executorRender{tmpl}
+}
+
+// noHTMLRender is used until templates are loaded
+type noHTMLRender struct{}
+
+func (noHTMLRender) Render(io.Writer, string, interface{}) error {
+	return errors.New("html: no templates loaded, see LoadHTMLGlob")
+}
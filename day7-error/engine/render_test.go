@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	texttemplate "text/template"
+)
+
+func newTemplateEngine() *Engine {
+	r := New()
+	r.SetFuncMap(template.FuncMap{
+		"fail": func() (string, error) { return "", errors.New("boom") },
+	})
+	r.SetHTMLRender(HTMLTemplate(template.Must(template.New("").Funcs(r.funcMap).Parse(
+		`{{define "ok"}}<p>{{.}}</p>{{end}}{{define "broken"}}<p>start</p>{{fail}}{{end}}`))))
+	r.Get("/ok", func(c *Context) {
+		c.HTML(http.StatusOK, "ok", "hello")
+	})
+	r.Get("/broken", func(c *Context) {
+		c.HTML(http.StatusOK, "broken", nil)
+	})
+	r.Get("/large", func(c *Context) {
+		c.HTML(http.StatusOK, "ok", strings.Repeat("x", 100))
+	})
+	return r
+}
+
+func TestHTMLBuffered(t *testing.T) {
+	r := newTemplateEngine()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/ok", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "<p>hello</p>" || w.Header().Get("Content-Length") != "12" {
+		t.Fatalf("unexpected page %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+}
+
+func TestHTMLTemplateErrorIsClean500(t *testing.T) {
+	r := newTemplateEngine()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/broken", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "start") || strings.Contains(w.Body.String(), "boom") {
+		t.Fatalf("partial page or private error leaked: %q", w.Body.String())
+	}
+}
+
+func TestHTMLStreamsLargePages(t *testing.T) {
+	r := newTemplateEngine()
+	r.SetHTMLBufferLimit(16)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/large", nil))
+	if w.Code != http.StatusOK || len(w.Body.String()) != 107 {
+		t.Fatalf("large page should be streamed entirely, got %d bytes", w.Body.Len())
+	}
+	if w.Header().Get("Content-Length") != "" {
+		t.Fatal("streamed page has no Content-Length")
+	}
+}
+
+// upperRender is a custom HTMLRender, it ignores templates
+type upperRender struct{}
+
+func (upperRender) Render(w io.Writer, name string, data interface{}) error {
+	_, err := fmt.Fprintf(w, "%s:%s", name, strings.ToUpper(fmt.Sprint(data)))
+	return err
+}
+
+func serveHTML(r *Engine, name string, data interface{}) *httptest.ResponseRecorder {
+	r.Get("/page", func(c *Context) {
+		c.HTML(http.StatusOK, name, data)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/page", nil))
+	return w
+}
+
+func TestHTMLRender(t *testing.T) {
+	r := New()
+	r.SetHTMLRender(upperRender{})
+	if w := serveHTML(r, "user", "tom"); w.Body.String() != "user:TOM" {
+		t.Fatalf("custom renderer should be used, got %q", w.Body.String())
+	}
+
+	r = New()
+	r.SetHTMLRender(TextTemplate(texttemplate.Must(texttemplate.New("raw").Parse(`<b>{{.}}</b>`))))
+	if w := serveHTML(r, "raw", "<i>x</i>"); w.Body.String() != "<b><i>x</i></b>" {
+		t.Fatalf("text/template should not escape, got %q", w.Body.String())
+	}
+
+	if w := serveHTML(New(), "user", nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("rendering without templates should give 500, got %d", w.Code)
+	}
+}
+
+func TestLoadHTMLFilesAndFS(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "user.tmpl", `<p>{{.}}</p>`)
+	writeTemplate(t, dir, "other.tmpl", `other`)
+	r := New()
+	r.LoadHTMLFiles(filepath.Join(dir, "user.tmpl"))
+	if w := serveHTML(r, "user.tmpl", "<tom>"); w.Body.String() != "<p>&lt;tom&gt;</p>" {
+		t.Fatalf("unexpected page %q", w.Body.String())
+	}
+
+	r = New()
+	r.LoadHTMLFS(fstest.MapFS{
+		"templates/user.tmpl": {Data: []byte(`{{define "user"}}<a href="{{asset "app.css"}}">{{.}}</a>{{end}}`)},
+	}, "templates/*.tmpl")
+	if err := r.StaticAssets("/assets", http.FS(fstest.MapFS{"app.css": {Data: []byte("a{}")}}), AssetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if w := serveHTML(r, "user", "tom"); !strings.HasPrefix(w.Body.String(), `<a href="/assets/app.`) {
+		t.Fatalf("unexpected page %q", w.Body.String())
+	}
+}
+
+func TestLoadHTMLFSDebug(t *testing.T) {
+	r := New()
+	r.SetDebug(true)
+	// no panic in debug mode, the error is shown on render
+	r.LoadHTMLFS(fstest.MapFS{"broken.tmpl": {Data: []byte(`{{.`)}}, "*.tmpl")
+	w := serveHTML(r, "broken.tmpl", nil)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "<h1>Template error</h1>") {
+		t.Fatalf("parse error should be shown, got %d %q", w.Code, w.Body.String())
+	}
+}
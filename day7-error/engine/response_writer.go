@@ -0,0 +1,202 @@
+// http.ResponseWriter wrapper tracking status, size and whether headers were sent
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+)
+
+const (
+	noWritten     = -1
+	defaultStatus = http.StatusOK
+)
+
+// ResponseWriter is the type of c.Writer. WriteHeader only records the status,
+// headers are sent with the first Write, Flush or WriteHeaderNow, so a handler can
+// still change its mind (and Content-Type) until output starts.
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Hijacker
+	http.Flusher
+	http.Pusher
+
+	// Status returns the HTTP status of the response, 200 until WriteHeader is called
+	Status() int
+	// Size returns the number of bytes written to the body, -1 if nothing was written
+	Size() int
+	// Written returns true once the headers were sent
+	Written() bool
+	// WriteHeaderNow forces the headers to be sent
+	WriteHeaderNow()
+	// WriteString writes s without converting it to []byte first when possible
+	WriteString(s string) (int, error)
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	size   int
+	status int
+	// hijacked is set once the connection belongs to the caller of Hijack
+	hijacked bool
+	// before runs right before the headers are sent, last chance to add cookies
+	before []func()
+}
+
+var _ ResponseWriter = (*responseWriter)(nil)
+
+func (w *responseWriter) reset(writer http.ResponseWriter) {
+	w.ResponseWriter = writer
+	w.size = noWritten
+	w.status = defaultStatus
+	w.hijacked = false
+	w.before = nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if code > 0 && w.status != code {
+		// a hijacked response is written by its new owner, the status is only recorded
+		if w.Written() && !w.hijacked {
+			log.Printf("[WARNING] Headers were already written. Wanted to override status code %d with %d", w.status, code)
+			return
+		}
+		w.status = code
+	}
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+		for _, fn := range w.before {
+			fn()
+		}
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// beforeWriteHeader registers fn to run right before the headers are sent
+func (w *responseWriter) beforeWriteHeader(fn func()) {
+	w.before = append(w.before, fn)
+}
+
+func (w *responseWriter) Write(data []byte) (n int, err error) {
+	w.WriteHeaderNow()
+	n, err = w.ResponseWriter.Write(data)
+	w.size += n
+	return
+}
+
+func (w *responseWriter) WriteString(s string) (n int, err error) {
+	w.WriteHeaderNow()
+	if sw, ok := w.ResponseWriter.(interface {
+		WriteString(string) (int, error)
+	}); ok {
+		n, err = sw.WriteString(s)
+	} else {
+		n, err = w.ResponseWriter.Write([]byte(s))
+	}
+	w.size += n
+	return
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.size != noWritten
+}
+
+// Hijack implements http.Hijacker, once it succeeds the connection belongs to the
+// caller and the response counts as written
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	if w.size < 0 {
+		w.size = 0
+	}
+	w.hijacked = true
+	return conn, brw, nil
+}
+
+// Flush implements http.Flusher, it sends the headers if needed
+func (w *responseWriter) Flush() {
+	w.WriteHeaderNow()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Push implements http.Pusher, it fails with http.ErrNotSupported on HTTP/1
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// copiedWriter is the writer of a Context returned by Copy, it reports the
+// response as written so helpers like Fail only record errors, and panics on
+// any real write
+type copiedWriter struct{}
+
+const errCopiedWrite = "engine: write to a copied Context, the response belongs to the original request"
+
+func (copiedWriter) Header() http.Header {
+	panic(errCopiedWrite)
+}
+
+func (copiedWriter) Write([]byte) (int, error) {
+	panic(errCopiedWrite)
+}
+
+func (copiedWriter) WriteString(string) (int, error) {
+	panic(errCopiedWrite)
+}
+
+func (copiedWriter) WriteHeader(int) {
+	panic(errCopiedWrite)
+}
+
+func (copiedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	panic(errCopiedWrite)
+}
+
+func (copiedWriter) Flush() {
+	panic(errCopiedWrite)
+}
+
+func (copiedWriter) Push(string, *http.PushOptions) error {
+	panic(errCopiedWrite)
+}
+
+func (copiedWriter) WriteHeaderNow() {}
+
+func (copiedWriter) Status() int {
+	return 0
+}
+
+func (copiedWriter) Size() int {
+	return noWritten
+}
+
+func (copiedWriter) Written() bool {
+	return true
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseWriterTracksDirectWrites(t *testing.T) {
+	r := New()
+	var status, size int
+	r.AppendMid(func(c *Context) {
+		c.Next()
+		status, size = c.Writer.Status(), c.Writer.Size()
+	})
+	r.Get("/raw", func(c *Context) {
+		c.Writer.WriteHeader(http.StatusCreated)
+		c.Writer.Write([]byte("hello"))
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/raw", nil))
+	if status != http.StatusCreated || size != 5 || w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 with 5 bytes, got %d with %d", status, size)
+	}
+}
+
+func TestResponseWriterHeadersWrittenOnce(t *testing.T) {
+	c, w := newTestContext("GET", "/")
+	if c.Writer.Written() || c.Writer.Size() != noWritten || c.Writer.Status() != http.StatusOK {
+		t.Fatal("fresh writer should be unwritten with status 200")
+	}
+	c.Plain(http.StatusOK, "partial")
+	// e.g. Recovery after the body started
+	c.Fail(http.StatusInternalServerError, "Internal Server Error")
+	if w.Code != http.StatusOK || c.Writer.Status() != http.StatusOK {
+		t.Fatal("status must not change once headers are sent")
+	}
+	if w.Body.String() != "partial" {
+		t.Fatalf("nothing should be appended to a started body, got %q", w.Body.String())
+	}
+}
+
+func TestResponseWriterStatusOnly(t *testing.T) {
+	r := New()
+	r.Get("/", func(c *Context) {
+		c.SetStatus(http.StatusNoContent)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("recorded status should be sent at the end of the chain, got %d", w.Code)
+	}
+}
+
+func TestResponseWriterInterfaces(t *testing.T) {
+	c, w := newTestContext("GET", "/")
+	c.Writer.Flush()
+	if !w.Flushed || !c.Writer.Written() {
+		t.Fatal("Flush should pass through and send the headers")
+	}
+	if err := c.Writer.Push("/app.js", nil); err != http.ErrNotSupported {
+		t.Fatal("Push should report http.ErrNotSupported without HTTP/2")
+	}
+	if _, _, err := c.Writer.Hijack(); err == nil {
+		t.Fatal("recorder can't be hijacked")
+	}
+}
+
+func TestContextStatusCode(t *testing.T) {
+	c, _ := newTestContext("GET", "/")
+	c.SetStatus(http.StatusCreated)
+	if c.StatusCode != http.StatusCreated || c.Writer.Status() != http.StatusCreated {
+		t.Fatal("SetStatus should keep the deprecated StatusCode in sync")
+	}
+	c.Writer.WriteHeaderNow()
+	// too late, the status sent stays
+	c.SetStatus(http.StatusTeapot)
+	if c.StatusCode != http.StatusCreated {
+		t.Fatalf("StatusCode should follow the status sent, got %d", c.StatusCode)
+	}
+}
@@ -92,14 +92,25 @@ func (r *router) handleRoute(c *Context) {
 		key := c.Method + "-" + node.pattern
 		c.handlers = append(c.handlers, r.handlers[key])
 	} else {
-		c.handlers = append(c.handlers, func(c *Context) {
-			c.Plain(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
-		})
+		c.notFound()
 	}
 	// after appended the router handler itself, we start the middleware chain execution
 	c.Next()
 }
 
+// notFound sets the 404 status and appends the NoRoute handlers to the chain,
+// so they run once the current handler returns
+func (c *Context) notFound() {
+	c.SetStatus(http.StatusNotFound)
+	if len(c.engine.noRoute) > 0 {
+		c.handlers = append(c.handlers, c.engine.noRoute...)
+		return
+	}
+	c.handlers = append(c.handlers, func(c *Context) {
+		c.Plain(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
+	})
+}
+
 // get all route entries of given method, i.e. return
 // all leaf nodes (with pattern defined)
 func (r *router) getRoutes(method string) []*node {
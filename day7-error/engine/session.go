@@ -0,0 +1,293 @@
+// session middleware, the session is loaded before the chain and saved after it
+package engine
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"time"
+)
+
+// sessionKey is the Keys entry holding the *Session of the request
+const sessionKey = "engine/session"
+
+const defaultIdleTimeout = 30 * time.Minute
+
+// Store loads and saves sessions. Values are gob encoded by the stores of this
+// package, custom types stored in a session must be registered with gob.Register.
+type Store interface {
+	// Load returns the session of the request, or a new one if there is none
+	Load(c *Context, name string) (*Session, error)
+	// Save persists s and sets what the client needs to send it back (cookie),
+	// a destroyed session is removed instead
+	Save(c *Context, name string, s *Session) error
+}
+
+// SessionOptions configures the Sessions middleware
+type SessionOptions struct {
+	// IdleTimeout expires a session not used for this long, default 30 minutes
+	IdleTimeout time.Duration
+	// AbsoluteTimeout expires a session this long after its creation whatever
+	// the activity, 0 means no absolute limit
+	AbsoluteTimeout time.Duration
+}
+
+// Session holds the values of one client between requests
+type Session struct {
+	id       string
+	values   map[string]interface{}
+	flashes  []interface{}
+	created  time.Time
+	accessed time.Time
+	expires  time.Time
+
+	isNew     bool
+	modified  bool
+	destroyed bool
+	oldID     string // previous id to delete after Regenerate
+}
+
+// sessionRecord is the persisted form of a Session
+type sessionRecord struct {
+	ID       string
+	Values   map[string]interface{}
+	Flashes  []interface{}
+	Created  time.Time
+	Accessed time.Time
+	Expires  time.Time
+}
+
+// NewSession returns an empty session with a fresh id, for Store implementations
+func NewSession() *Session {
+	now := time.Now()
+	return &Session{
+		id:       newSessionID(),
+		values:   make(map[string]interface{}),
+		created:  now,
+		accessed: now,
+		isNew:    true,
+	}
+}
+
+// newSessionID returns 128 random bits in hex
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// validSessionID rejects anything that isn't a newSessionID, ids end up in file names
+func validSessionID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew returns true if the session didn't come with the request
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+func (s *Session) Get(key string) interface{} {
+	return s.values[key]
+}
+
+func (s *Session) Set(key string, value interface{}) {
+	s.values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	delete(s.values, key)
+	s.modified = true
+}
+
+// Clear removes every value but keeps the session
+func (s *Session) Clear() {
+	s.values = make(map[string]interface{})
+	s.modified = true
+}
+
+// AddFlash queues a value for the next Flashes call, usually on the next request
+func (s *Session) AddFlash(value interface{}) {
+	s.flashes = append(s.flashes, value)
+	s.modified = true
+}
+
+// Flashes returns and removes the queued flash values
+func (s *Session) Flashes() []interface{} {
+	flashes := s.flashes
+	if len(flashes) > 0 {
+		s.flashes = nil
+		s.modified = true
+	}
+	return flashes
+}
+
+// Regenerate gives the session a new id and keeps its values, call it on login
+// (or any privilege change) to prevent session fixation
+func (s *Session) Regenerate() {
+	if !s.isNew && s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = newSessionID()
+	s.modified = true
+}
+
+// Destroy removes the session from the store and the client, e.g. on logout
+func (s *Session) Destroy() {
+	s.destroyed = true
+	s.values = make(map[string]interface{})
+	s.flashes = nil
+}
+
+// expired checks the timeouts at time now
+func (s *Session) expired(now time.Time, opts SessionOptions) bool {
+	if now.Sub(s.accessed) > opts.IdleTimeout {
+		return true
+	}
+	return opts.AbsoluteTimeout > 0 && now.Sub(s.created) > opts.AbsoluteTimeout
+}
+
+// expiry is the time the session expires if it isn't used anymore
+func (s *Session) expiry(opts SessionOptions) time.Time {
+	expires := s.accessed.Add(opts.IdleTimeout)
+	if opts.AbsoluteTimeout > 0 {
+		if absolute := s.created.Add(opts.AbsoluteTimeout); absolute.Before(expires) {
+			expires = absolute
+		}
+	}
+	return expires
+}
+
+// shouldSave avoids creating sessions for clients that never used one
+func (s *Session) shouldSave() bool {
+	if s.isNew {
+		// an expired predecessor still has to be removed
+		return (s.modified || s.oldID != "") && !s.destroyed
+	}
+	return true
+}
+
+// MaxAge is the cookie max age matching the session expiry, -1 deletes the cookie
+func (s *Session) MaxAge() int {
+	if s.destroyed {
+		return -1
+	}
+	if s.expires.IsZero() {
+		return 0
+	}
+	maxAge := int(time.Until(s.expires).Seconds())
+	if maxAge <= 0 {
+		return -1
+	}
+	return maxAge
+}
+
+// Expires returns the expiry computed by the middleware before Save
+func (s *Session) Expires() time.Time {
+	return s.expires
+}
+
+// Destroyed reports whether Destroy was called, stores delete such sessions
+func (s *Session) Destroyed() bool {
+	return s.destroyed
+}
+
+// PreviousID returns the id replaced by Regenerate, stores delete it on Save
+func (s *Session) PreviousID() string {
+	return s.oldID
+}
+
+// MarshalSession serializes s for a store
+func MarshalSession(s *Session) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&sessionRecord{
+		ID:       s.id,
+		Values:   s.values,
+		Flashes:  s.flashes,
+		Created:  s.created,
+		Accessed: s.accessed,
+		Expires:  s.expires,
+	})
+	return buf.Bytes(), err
+}
+
+// UnmarshalSession restores a session saved with MarshalSession
+func UnmarshalSession(data []byte) (*Session, error) {
+	var record sessionRecord
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&record); err != nil {
+		return nil, err
+	}
+	if record.Values == nil {
+		record.Values = make(map[string]interface{})
+	}
+	return &Session{
+		id:       record.ID,
+		values:   record.Values,
+		flashes:  record.Flashes,
+		created:  record.Created,
+		accessed: record.Accessed,
+		expires:  record.Expires,
+	}, nil
+}
+
+// Sessions loads the session called name from store into the Context, handlers
+// reach it with c.Session(). The session is saved right before the headers are
+// sent, or after Next returns if nothing was written; changes made after the
+// response started are lost.
+//
+//	r.AppendMid(engine.Sessions("sid", engine.NewMemoryStore(time.Minute), engine.SessionOptions{}))
+func Sessions(name string, store Store, opts SessionOptions) HandlerFunc {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultIdleTimeout
+	}
+	return func(c *Context) {
+		now := time.Now()
+		s, err := store.Load(c, name)
+		if err != nil {
+			c.Error(err)
+			s = nil
+		}
+		if s == nil {
+			s = NewSession()
+		} else if !s.isNew && s.expired(now, opts) {
+			// drop the expired session, its id is deleted from the store on save
+			fresh := NewSession()
+			fresh.oldID = s.id
+			s = fresh
+		}
+		s.accessed = now
+		c.Set(sessionKey, s)
+
+		saved := false
+		save := func() {
+			if saved || !s.shouldSave() {
+				return
+			}
+			saved = true
+			s.expires = s.expiry(opts)
+			if err := store.Save(c, name, s); err != nil {
+				c.Error(err)
+			}
+		}
+		c.writermem.beforeWriteHeader(save)
+		c.Next()
+		save()
+	}
+}
+
+// Session returns the session loaded by the Sessions middleware, nil without it
+func (c *Context) Session() *Session {
+	s, _ := GetAs[*Session](c, sessionKey)
+	return s
+}
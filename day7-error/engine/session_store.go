@@ -0,0 +1,298 @@
+// session stores: in-memory, filesystem and cookie backed
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrSessionTooLarge = errors.New("session: encoded session doesn't fit in a cookie")
+
+// maxCookieSize is the usual browser limit for a single cookie
+const maxCookieSize = 4096
+
+// loadByID reads the session id cookie and loads the session with read,
+// read returns nil data for an unknown id
+func loadByID(c *Context, name string, read func(id string) ([]byte, error)) (*Session, error) {
+	id, err := c.Cookie(name)
+	if err != nil || !validSessionID(id) {
+		return NewSession(), nil
+	}
+	data, err := read(id)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return NewSession(), nil
+	}
+	s, err := UnmarshalSession(data)
+	if err != nil {
+		return nil, err
+	}
+	// a session may only be loaded under the id it was saved with
+	if s.id != id {
+		return NewSession(), nil
+	}
+	return s, nil
+}
+
+// saveByID persists s with write, removes outdated ids and sets the id cookie
+func saveByID(c *Context, name string, s *Session, write func(id string, data []byte, expires time.Time) error, remove func(id string) error) error {
+	if old := s.PreviousID(); old != "" {
+		if err := remove(old); err != nil {
+			return err
+		}
+	}
+	if s.Destroyed() {
+		c.SetCookie(name, "", -1)
+		return remove(s.ID())
+	}
+	data, err := MarshalSession(s)
+	if err != nil {
+		return err
+	}
+	if err := write(s.ID(), data, s.Expires()); err != nil {
+		return err
+	}
+	c.SetCookie(name, s.ID(), s.MaxAge())
+	return nil
+}
+
+// MemoryStore keeps sessions in the process memory, expired sessions are
+// swept periodically. Sessions are lost on restart and not shared between instances.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+	stop     chan struct{}
+	once     sync.Once
+}
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore is the constructor of MemoryStore, expired sessions are
+// removed every sweepInterval until Close is called. With a sweepInterval <= 0
+// nothing runs in the background, call Sweep by hand or expired sessions pile up.
+func NewMemoryStore(sweepInterval time.Duration) *MemoryStore {
+	store := &MemoryStore{
+		sessions: make(map[string]memoryEntry),
+		stop:     make(chan struct{}),
+	}
+	if sweepInterval > 0 {
+		go store.sweepLoop(sweepInterval)
+	}
+	return store
+}
+
+func (store *MemoryStore) Load(c *Context, name string) (*Session, error) {
+	return loadByID(c, name, store.read)
+}
+
+func (store *MemoryStore) Save(c *Context, name string, s *Session) error {
+	return saveByID(c, name, s, store.write, store.remove)
+}
+
+func (store *MemoryStore) read(id string) ([]byte, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	entry, ok := store.sessions[id]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, nil
+	}
+	return entry.data, nil
+}
+
+func (store *MemoryStore) write(id string, data []byte, expires time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.sessions[id] = memoryEntry{data: data, expires: expires}
+	return nil
+}
+
+func (store *MemoryStore) remove(id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.sessions, id)
+	return nil
+}
+
+// Len returns the number of stored sessions, expired ones included until swept
+func (store *MemoryStore) Len() int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return len(store.sessions)
+}
+
+// Sweep removes the expired sessions
+func (store *MemoryStore) Sweep() {
+	now := time.Now()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for id, entry := range store.sessions {
+		if now.After(entry.expires) {
+			delete(store.sessions, id)
+		}
+	}
+}
+
+func (store *MemoryStore) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			store.Sweep()
+		case <-store.stop:
+			return
+		}
+	}
+}
+
+// Close stops the sweeping goroutine
+func (store *MemoryStore) Close() {
+	store.once.Do(func() {
+		close(store.stop)
+	})
+}
+
+// FileStore keeps one file per session in a directory, so sessions survive
+// restarts. The expiry is checked on load, Sweep removes the stale files.
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore is the constructor of FileStore, dir is created if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (store *FileStore) Load(c *Context, name string) (*Session, error) {
+	return loadByID(c, name, store.read)
+}
+
+func (store *FileStore) Save(c *Context, name string, s *Session) error {
+	return saveByID(c, name, s, store.write, store.remove)
+}
+
+// path is only called with ids checked by validSessionID
+func (store *FileStore) path(id string) string {
+	return filepath.Join(store.dir, "session_"+id)
+}
+
+func (store *FileStore) read(id string) ([]byte, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	data, err := os.ReadFile(store.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, err := UnmarshalSession(data)
+	if err != nil || time.Now().After(s.Expires()) {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// write goes through a temp file so a crash never leaves a truncated session
+func (store *FileStore) write(id string, data []byte, expires time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	tmp, err := os.CreateTemp(store.dir, "tmp_session_")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), store.path(id))
+}
+
+func (store *FileStore) remove(id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := os.Remove(store.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Sweep removes the files of expired sessions
+func (store *FileStore) Sweep() error {
+	files, err := filepath.Glob(filepath.Join(store.dir, "session_*"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if s, err := UnmarshalSession(data); err != nil || now.After(s.Expires()) {
+			store.mu.Lock()
+			os.Remove(file)
+			store.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// CookieStore keeps the whole session in an encrypted cookie, nothing is stored
+// server side. It needs Engine.SetEncryptionKeys and is limited to ~4KB of data.
+type CookieStore struct{}
+
+var _ Store = CookieStore{}
+
+func (CookieStore) Load(c *Context, name string) (*Session, error) {
+	raw, err := c.EncryptedCookie(name)
+	if errors.Is(err, ErrNoCookieKeys) {
+		return nil, err
+	}
+	// missing, forged or encrypted with a retired key: start over
+	if err != nil {
+		return NewSession(), nil
+	}
+	s, err := UnmarshalSession([]byte(raw))
+	if err != nil {
+		return NewSession(), nil
+	}
+	return s, nil
+}
+
+func (CookieStore) Save(c *Context, name string, s *Session) error {
+	if s.Destroyed() {
+		c.SetCookie(name, "", -1)
+		return nil
+	}
+	data, err := MarshalSession(s)
+	if err != nil {
+		return err
+	}
+	// base64 of nonce + data + tag
+	if (len(data)+28)*4/3 > maxCookieSize {
+		return ErrSessionTooLarge
+	}
+	return c.SetEncryptedCookie(name, string(data), s.MaxAge())
+}
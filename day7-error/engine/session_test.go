@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// sessionClient replays the cookies it receives like a browser
+type sessionClient struct {
+	t       *testing.T
+	engine  *Engine
+	cookies map[string]*http.Cookie
+}
+
+func (sc *sessionClient) get(target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	for _, cookie := range sc.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	sc.engine.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(sc.cookies, cookie.Name)
+		} else {
+			sc.cookies[cookie.Name] = cookie
+		}
+	}
+	return w
+}
+
+func newSessionEngine(t *testing.T, store Store, opts SessionOptions) *sessionClient {
+	r := New()
+	r.AppendMid(Sessions("sid", store, opts))
+	r.Get("/login", func(c *Context) {
+		s := c.Session()
+		s.Regenerate()
+		s.Set("user", "tom")
+		s.AddFlash("welcome")
+		c.Plain(http.StatusOK, "%s", s.ID())
+	})
+	r.Get("/me", func(c *Context) {
+		s := c.Session()
+		flashes := s.Flashes()
+		c.Plain(http.StatusOK, "%v %d", s.Get("user"), len(flashes))
+	})
+	r.Get("/logout", func(c *Context) {
+		c.Session().Destroy()
+	})
+	r.Get("/anonymous", func(c *Context) {
+		c.Plain(http.StatusOK, "hi")
+	})
+	return &sessionClient{t: t, engine: r, cookies: make(map[string]*http.Cookie)}
+}
+
+func testSessionStore(t *testing.T, store Store) {
+	sc := newSessionEngine(t, store, SessionOptions{})
+	sc.get("/anonymous")
+	if len(sc.cookies) != 0 {
+		t.Fatal("untouched session should not be saved")
+	}
+
+	sc.get("/login")
+	if w := sc.get("/me"); w.Body.String() != "tom 1" {
+		t.Fatalf("session value and flash expected, got %q", w.Body.String())
+	}
+	if w := sc.get("/me"); w.Body.String() != "tom 0" {
+		t.Fatalf("flash should be shown once, got %q", w.Body.String())
+	}
+
+	sc.get("/logout")
+	if w := sc.get("/me"); w.Body.String() != "<nil> 0" {
+		t.Fatalf("destroyed session should be gone, got %q", w.Body.String())
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	testSessionStore(t, store)
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSessionStore(t, store)
+}
+
+func TestCookieStore(t *testing.T) {
+	sc := newSessionEngine(t, CookieStore{}, SessionOptions{})
+	sc.engine.SetEncryptionKeys(bytes.Repeat([]byte("k"), 32))
+	sc.get("/login")
+	if w := sc.get("/me"); w.Body.String() != "tom 1" {
+		t.Fatalf("cookie session value expected, got %q", w.Body.String())
+	}
+	sc.get("/logout")
+	if w := sc.get("/me"); w.Body.String() != "<nil> 0" {
+		t.Fatalf("destroyed session should be gone, got %q", w.Body.String())
+	}
+}
+
+func TestSessionRegenerate(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	sc := newSessionEngine(t, store, SessionOptions{})
+	first := sc.get("/login").Body.String()
+	second := sc.get("/login").Body.String()
+	if first == second {
+		t.Fatal("login should regenerate the session id")
+	}
+	if store.Len() != 1 {
+		t.Fatalf("the previous session id should be deleted, %d sessions stored", store.Len())
+	}
+	// a client still holding the old id doesn't get the session
+	sc.cookies["sid"].Value = first
+	if w := sc.get("/me"); w.Body.String() != "<nil> 0" {
+		t.Fatalf("old session id should be invalid, got %q", w.Body.String())
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	sc := newSessionEngine(t, store, SessionOptions{IdleTimeout: 50 * time.Millisecond})
+	sc.get("/login")
+	time.Sleep(80 * time.Millisecond)
+	if w := sc.get("/me"); w.Body.String() != "<nil> 0" {
+		t.Fatalf("idle session should expire, got %q", w.Body.String())
+	}
+
+	sc = newSessionEngine(t, store, SessionOptions{AbsoluteTimeout: 80 * time.Millisecond})
+	sc.get("/login")
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		sc.get("/me")
+	}
+	if w := sc.get("/me"); w.Body.String() != "<nil> 0" {
+		t.Fatalf("session should expire after the absolute timeout despite activity, got %q", w.Body.String())
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	defer store.Close()
+	store.write(newSessionID(), []byte("x"), time.Now().Add(-time.Second))
+	store.write(newSessionID(), []byte("x"), time.Now().Add(time.Hour))
+	store.Sweep()
+	if store.Len() != 1 {
+		t.Fatal("sweep should only remove expired sessions")
+	}
+}
+
+func TestMemoryStoreWithoutSweep(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		// must not start a ticker, it would panic in its goroutine
+		store := NewMemoryStore(interval)
+		store.write(newSessionID(), []byte("x"), time.Now().Add(-time.Second))
+		store.Sweep()
+		if store.Len() != 0 {
+			t.Fatal("manual sweep should remove expired sessions")
+		}
+		store.Close()
+	}
+}
@@ -0,0 +1,75 @@
+// single-page application serving: real files from disk, index.html for client side routes
+package engine
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// StaticSPA serves the files of root under relativePath and answers every other
+// GET below it with the index file, so the client side router of the app can
+// handle deep links like /app/users/42. Paths of nested groups (e.g. /api when
+// the app is served at /) and missing files with an extension (e.g. /app/main.js)
+// are still a 404, the index is sent with no-cache so new deployments are picked up.
+//
+//	r.StaticSPA("/", "./web/dist", "index.html")
+func (group *RouterGroup) StaticSPA(relativePath string, root string, index string) {
+	checkStaticPath(relativePath)
+	fs := Dir(root, false)
+	absolutePath := path.Join(group.prefix, relativePath)
+	indexPath := path.Join("/", index)
+	static := group.createStaticHandler(relativePath, fs)
+
+	handler := func(c *Context) {
+		if group.engine.inNestedGroup(absolutePath, c.Path) {
+			c.notFound()
+			return
+		}
+		file := c.Param("filepath")
+		name := path.Join("/", file)
+		if name == indexPath {
+			c.SetHeader("Cache-Control", "no-cache")
+		}
+		// invalid paths are rejected by the static handler
+		if !validStaticPath(file) || isFile(fs, name) {
+			static(c)
+			return
+		}
+		// looks like an asset, index.html would be served with the wrong type
+		if path.Ext(name) != "" {
+			c.notFound()
+			return
+		}
+		c.SetHeader("Cache-Control", "no-cache")
+		if !c.serveFile(fs, indexPath) {
+			c.notFound()
+		}
+	}
+	// /*filepath doesn't match the prefix itself
+	group.Get(relativePath, handler)
+	group.Get(path.Join(relativePath, "/*filepath"), handler)
+}
+
+// inNestedGroup reports whether p belongs to a group nested under prefix
+func (engine *Engine) inNestedGroup(prefix string, p string) bool {
+	for _, group := range engine.groups {
+		if len(group.prefix) <= len(prefix) || !strings.HasPrefix(group.prefix, prefix) {
+			continue
+		}
+		if p == group.prefix || strings.HasPrefix(p, group.prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isFile(fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	return err == nil && !stat.IsDir()
+}
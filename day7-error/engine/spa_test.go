@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestStaticSPA(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "index.html", "<div id=root></div>")
+	writeTemplate(t, dir, "assets/main.js", "render()")
+	r := New()
+	api := r.Group("/api")
+	api.Get("/users", func(c *Context) {
+		c.JSON(http.StatusOK, H{"users": []string{"tom"}})
+	})
+	r.StaticSPA("/", dir, "index.html")
+
+	for _, target := range []string{"/", "/users/42", "/settings"} {
+		w := serveWith(r, "GET", target, nil)
+		if w.Code != http.StatusOK || w.Body.String() != "<div id=root></div>" || w.Header().Get("Cache-Control") != "no-cache" {
+			t.Fatalf("%s should serve the index, got %d %q %v", target, w.Code, w.Body.String(), w.Header())
+		}
+	}
+	w := serveWith(r, "GET", "/assets/main.js", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "render()" || w.Header().Get("Cache-Control") != "" {
+		t.Fatalf("real files should be served, got %d %q", w.Code, w.Body.String())
+	}
+	w = serveWith(r, "GET", "/index.html", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("index should never be cached, got %d %v", w.Code, w.Header())
+	}
+	w = serveWith(r, "GET", "/assets/missing.js", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("missing asset should give 404, got %d", w.Code)
+	}
+	w = serveWith(r, "GET", "/api/users", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("api routes should still work, got %d", w.Code)
+	}
+	w = serveWith(r, "GET", "/api/unknown", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown api route should give 404, got %d", w.Code)
+	}
+	w = serveWith(r, "GET", "/../index.html", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("traversal should be rejected, got %d", w.Code)
+	}
+}
+
+func TestStaticSPAUnderPrefix(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "app.html", "app")
+	r := New()
+	r.Group("/app").StaticSPA("/", dir, "app.html")
+
+	for _, target := range []string{"/app", "/app/profile"} {
+		if w := serveWith(r, "GET", target, nil); w.Code != http.StatusOK || w.Body.String() != "app" {
+			t.Fatalf("%s should serve the index, got %d %q", target, w.Code, w.Body.String())
+		}
+	}
+	if w := serveWith(r, "GET", "/other", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("paths outside the prefix are not part of the app, got %d", w.Code)
+	}
+}
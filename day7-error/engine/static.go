@@ -0,0 +1,301 @@
+// static file serving from a directory, any http.FileSystem or an io/fs.FS such as embed.FS
+package engine
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Dir returns the http.FileSystem of the directory root for StaticFS,
+// directories are only listed when listDirectory is true
+func Dir(root string, listDirectory bool) http.FileSystem {
+	if listDirectory {
+		return ListDirectory(http.Dir(root))
+	}
+	return http.Dir(root)
+}
+
+// ListDirectory opts fs into directory listings, a static route answers 404
+// for a directory without index.html otherwise
+func ListDirectory(fs http.FileSystem) http.FileSystem {
+	return listDirFS{fs}
+}
+
+type listDirFS struct {
+	http.FileSystem
+}
+
+// create static handler
+func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileSystem) HandlerFunc {
+	absolutePath := path.Join(group.prefix, relativePath)
+	_, listing := fs.(listDirFS)
+	// http.StripPrefix(absolutePath, ...) removes the absolutePath prefix from the request URL before
+	// passing it to the file server. This ensures that the correct file is served based on the relative path.
+	// e.g. r.Static("/assets", "/usr/geektutu/blog/static")
+	// here xxx/assets/*filepath removes xxx/assets/ and leave the correct file path
+	// so user localhost:9999/assets/js/geektutu.js returns /usr/geektutu/blog/static/js/geektutu.js
+	// the file server only renders directory listings, files go through http.ServeContent
+	fileServer := http.StripPrefix(absolutePath, http.FileServer(fs))
+	return func(c *Context) {
+		file := c.Param("filepath")
+		if !validStaticPath(file) {
+			c.Fail(http.StatusBadRequest, "invalid path")
+			return
+		}
+		name := "/" + file
+		f, err := fs.Open(name)
+		if err != nil {
+			c.notFound()
+			return
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			c.notFound()
+			return
+		}
+		if !stat.IsDir() {
+			c.serveContent(fs, name, f, stat)
+			return
+		}
+		// relative links of an index page need the trailing slash
+		if !strings.HasSuffix(c.Req.URL.Path, "/") {
+			c.redirectToDir()
+			return
+		}
+		if c.serveFile(fs, path.Join(name, "index.html")) {
+			return
+		}
+		if listing {
+			fileServer.ServeHTTP(c.Writer, c.Req)
+			return
+		}
+		c.notFound()
+	}
+}
+
+// validStaticPath rejects .. segments, backslashes (a separator on Windows) and NUL,
+// http.Dir would clean most of them but a traversal attempt deserves a 400
+func validStaticPath(name string) bool {
+	if strings.ContainsAny(name, "\\\x00") {
+		return false
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// serveFile serves the regular file name of fs, false if there is none
+func (c *Context) serveFile(fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		return false
+	}
+	c.serveContent(fs, name, f, stat)
+	return true
+}
+
+// precompressed siblings of static files, in order of preference on equal q-values
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// serveContent serves f, or its precompressed sibling name.br or name.gz when
+// the client accepts that encoding. The sibling keeps the Content-Type of name,
+// Range and conditional requests then apply to the encoded bytes.
+func (c *Context) serveContent(fs http.FileSystem, name string, f http.File, stat os.FileInfo) {
+	accept := c.Req.Header.Get("Accept-Encoding")
+	var (
+		best     http.File
+		bestStat os.FileInfo
+		encoding string
+		bestQ    float64
+		vary     bool
+	)
+	for _, p := range precompressed {
+		sibling, err := fs.Open(name + p.ext)
+		if err != nil {
+			continue
+		}
+		siblingStat, err := sibling.Stat()
+		if err != nil || siblingStat.IsDir() {
+			sibling.Close()
+			continue
+		}
+		// the response depends on Accept-Encoding as soon as a variant exists
+		vary = true
+		if q := acceptEncoding(accept, p.encoding); q > bestQ {
+			if best != nil {
+				best.Close()
+			}
+			best, bestStat, encoding, bestQ = sibling, siblingStat, p.encoding, q
+		} else {
+			sibling.Close()
+		}
+	}
+	header := c.Writer.Header()
+	if vary {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if best == nil {
+		setFileETag(header, f)
+		http.ServeContent(c.Writer, c.Req, stat.Name(), stat.ModTime(), f)
+		return
+	}
+	defer best.Close()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", contentType(name, f))
+	}
+	header.Set("Content-Encoding", encoding)
+	setFileETag(header, best)
+	http.ServeContent(c.Writer, c.Req, stat.Name(), bestStat.ModTime(), best)
+}
+
+// setFileETag sets the ETag of a file implementing ETag() string, like the
+// files of ArchiveFS, http.ServeContent then honours If-None-Match and If-Range
+func setFileETag(header http.Header, f http.File) {
+	if tagged, ok := f.(interface{ ETag() string }); ok && header.Get("ETag") == "" {
+		if etag := tagged.ETag(); etag != "" {
+			header.Set("ETag", etag)
+		}
+	}
+}
+
+// acceptEncoding returns the q-value of coding in an Accept-Encoding header,
+// "*" covers the codings not listed and a missing q means 1
+func acceptEncoding(header string, coding string) float64 {
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(param, "=")
+			if ok && strings.EqualFold(strings.TrimSpace(k), "q") {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if strings.EqualFold(name, coding) {
+			return q
+		}
+		if name == "*" {
+			wildcard = q
+		}
+	}
+	if wildcard > 0 {
+		return wildcard
+	}
+	return 0
+}
+
+// contentType of name from its extension, sniffed from f like ServeContent does otherwise
+func contentType(name string, f io.ReadSeeker) string {
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		return ctype
+	}
+	var buf [512]byte
+	n, _ := io.ReadFull(f, buf[:])
+	f.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n])
+}
+
+func (c *Context) redirectToDir() {
+	target := path.Base(c.Req.URL.Path) + "/"
+	if c.Req.URL.RawQuery != "" {
+		target += "?" + c.Req.URL.RawQuery
+	}
+	c.SetHeader("Location", target)
+	c.AbortWithStatus(http.StatusMovedPermanently)
+}
+
+// GET relativePath/*filepath to map fs root path to relativePath
+// r.Static("/assets", "/usr/geektutu/blog/static") so when requesting
+// localhost:9999/assets/js/geektutu.js, it returns /usr/geektutu/blog/static/js/geektutu.js
+// directories are not listed, use StaticFS(relativePath, Dir(root, true)) for that
+func (group *RouterGroup) Static(relativePath string, root string) {
+	group.StaticFS(relativePath, Dir(root, false))
+}
+
+// StaticFS works like Static with any http.FileSystem
+func (group *RouterGroup) StaticFS(relativePath string, fs http.FileSystem) {
+	checkStaticPath(relativePath)
+	handler := group.createStaticHandler(relativePath, fs)
+	urlPattern := path.Join(relativePath, "/*filepath")
+	// Register GET handlers, /*filepath doesn't match the root directory itself
+	group.Get(relativePath, handler)
+	group.Get(urlPattern, handler)
+}
+
+// StaticEmbed serves the root directory of an io/fs.FS, typically assets built
+// into the binary with embed, root "." serves the whole fsys
+//
+//	//go:embed static
+//	var staticFS embed.FS
+//
+//	r.StaticEmbed("/assets", staticFS, "static")
+func (group *RouterGroup) StaticEmbed(relativePath string, fsys fs.FS, root string) {
+	sub, err := fs.Sub(fsys, root)
+	if err != nil {
+		panic(err)
+	}
+	group.StaticFS(relativePath, http.FS(sub))
+}
+
+// StaticFile registers a single file of the local filesystem,
+// r.StaticFile("/favicon.ico", "./static/favicon.ico")
+func (group *RouterGroup) StaticFile(relativePath string, name string) {
+	checkStaticPath(relativePath)
+	group.Get(relativePath, func(c *Context) {
+		c.File(name)
+	})
+}
+
+// StaticFileFS registers a single file of fs, name is relative to its root
+func (group *RouterGroup) StaticFileFS(relativePath string, name string, fs http.FileSystem) {
+	checkStaticPath(relativePath)
+	group.Get(relativePath, func(c *Context) {
+		c.FileFromFS(name, fs)
+	})
+}
+
+// static routes are plain paths, parameters would never reach the file server
+func checkStaticPath(relativePath string) {
+	if strings.ContainsAny(relativePath, ":*") {
+		panic("URL parameters can not be used when serving static files")
+	}
+}
+
+// File writes the named file of the local filesystem, with the conditional
+// and Range handling of http.ServeContent, a missing file or a directory is a 404
+func (c *Context) File(name string) {
+	dir, file := filepath.Split(name)
+	c.FileFromFS(file, http.Dir(dir))
+}
+
+// FileFromFS writes the file name of fs, see File
+func (c *Context) FileFromFS(name string, fs http.FileSystem) {
+	if !c.serveFile(fs, path.Join("/", name)) {
+		c.notFound()
+	}
+}
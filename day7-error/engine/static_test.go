@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStaticEmbed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"static/css/site.css": {Data: []byte("body{}")},
+		"static/file1.txt":    {Data: []byte("hello")},
+		"secret.txt":          {Data: []byte("not served")},
+	}
+	r := New()
+	r.StaticEmbed("/assets", fsys, "static")
+
+	w := serveWith(r, "GET", "/assets/css/site.css", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "body{}" || w.Header().Get("Content-Type") != "text/css; charset=utf-8" {
+		t.Fatalf("unexpected response %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	w = serveWith(r, "GET", "/assets/missing.txt", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("missing file should give 404, got %d", w.Code)
+	}
+}
+
+func TestStaticFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "favicon.ico"), []byte("icon"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := New()
+	r.StaticFile("/favicon.ico", filepath.Join(dir, "favicon.ico"))
+	r.StaticFileFS("/robots.txt", "robots.txt", http.FS(fstest.MapFS{"robots.txt": {Data: []byte("User-agent: *")}}))
+
+	w := serveWith(r, "GET", "/favicon.ico", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "icon" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	w = serveWith(r, "GET", "/robots.txt", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "User-agent: *" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestStaticRejectsParams(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("StaticFile with a parameter should panic")
+		}
+	}()
+	New().StaticFile("/:name", "favicon.ico")
+}
+
+// countingFS records open handles to check that the static handler closes them
+type countingFS struct {
+	http.FileSystem
+	open *int
+}
+
+type countingFile struct {
+	http.File
+	open *int
+}
+
+func (fs countingFS) Open(name string) (http.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	*fs.open++
+	return countingFile{f, fs.open}, nil
+}
+
+func (f countingFile) Close() error {
+	*f.open--
+	return f.File.Close()
+}
+
+func newStaticDir(t *testing.T) string {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"file1.txt":       "hello",
+		"docs/index.html": "<p>docs</p>",
+		"css/site.css":    "body{}",
+	} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestStaticDirectories(t *testing.T) {
+	dir := newStaticDir(t)
+	open := 0
+	r := New()
+	r.StaticFS("/assets", countingFS{Dir(dir, false), &open})
+	r.StaticFS("/public", Dir(dir, true))
+
+	w := serveWith(r, "GET", "/assets/file1.txt", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" || w.Header().Get("Last-Modified") == "" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	w = serveWith(r, "GET", "/assets/css/", nil)
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "site.css") {
+		t.Fatalf("directories should not be listed by default, got %d %q", w.Code, w.Body.String())
+	}
+	w = serveWith(r, "GET", "/assets/docs", nil)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "docs/" {
+		t.Fatalf("directory should be redirected to its slash form, got %d %v", w.Code, w.Header())
+	}
+	w = serveWith(r, "GET", "/assets/docs/", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "<p>docs</p>" {
+		t.Fatalf("index.html should be served, got %d %q", w.Code, w.Body.String())
+	}
+	serveWith(r, "GET", "/assets/missing.txt", nil)
+	if open != 0 {
+		t.Fatalf("%d file handles were leaked", open)
+	}
+
+	w = serveWith(r, "GET", "/public/css/", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "site.css") {
+		t.Fatalf("listing should be opt-in, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestStaticRejectsTraversal(t *testing.T) {
+	r := New()
+	r.Static("/assets", newStaticDir(t))
+	for _, target := range []string{"/assets/../go.mod", "/assets/css/%2e%2e/%2e%2e/go.mod", "/assets/..%5cgo.mod"} {
+		if w := serveWith(r, "GET", target, nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s should be rejected, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestNoRoute(t *testing.T) {
+	r := New()
+	r.Static("/assets", newStaticDir(t))
+	r.NoRoute(func(c *Context) {
+		c.JSON(c.Writer.Status(), H{"message": "nothing at " + c.Path})
+	})
+
+	for _, target := range []string{"/unknown", "/assets/missing.txt"} {
+		code, obj := serveJSON(t, r, "GET", target)
+		if code != http.StatusNotFound || obj["message"] != "nothing at "+target {
+			t.Fatalf("%s should go through NoRoute, got %d %v", target, code, obj)
+		}
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	js := strings.Repeat("console.log('app');\n", 50)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(js))
+	zw.Close()
+	built := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := New()
+	r.StaticFS("/assets", http.FS(fstest.MapFS{
+		"app.js":    {Data: []byte(js), ModTime: built},
+		"app.js.gz": {Data: gz.Bytes(), ModTime: built},
+		// content doesn't matter, no brotli encoder in the standard library
+		"app.js.br": {Data: []byte("brotli bytes"), ModTime: built},
+		"plain.txt": {Data: []byte("plain"), ModTime: built},
+	}))
+
+	w := serveWith(r, "GET", "/assets/app.js", map[string]string{"Accept-Encoding": "gzip, deflate, br"})
+	if w.Body.String() != "brotli bytes" || w.Header().Get("Content-Encoding") != "br" ||
+		w.Header().Get("Vary") != "Accept-Encoding" || w.Header().Get("Content-Type") != "text/javascript; charset=utf-8" {
+		t.Fatalf("brotli should be preferred, got %q %v", w.Body.String(), w.Header())
+	}
+
+	w = serveWith(r, "GET", "/assets/app.js", map[string]string{"Accept-Encoding": "br;q=0.5, gzip"})
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("higher q-value should win, got %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != js {
+		t.Fatal("gzip variant should decode to the original file")
+	}
+
+	w = serveWith(r, "GET", "/assets/app.js", map[string]string{"Accept-Encoding": "gzip;q=0, identity"})
+	if w.Body.String() != js || w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("plain file should be the fallback, got %v", w.Header())
+	}
+
+	w = serveWith(r, "GET", "/assets/app.js", map[string]string{"Accept-Encoding": "*", "Range": "bytes=0-3"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "brot" || w.Header().Get("Content-Encoding") != "br" {
+		t.Fatalf("Range should apply to the encoded variant, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = serveWith(r, "GET", "/assets/app.js", map[string]string{"Accept-Encoding": "gzip", "If-Modified-Since": built.Format(http.TimeFormat)})
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("conditional requests should still work, got %d", w.Code)
+	}
+
+	w = serveWith(r, "GET", "/assets/plain.txt", map[string]string{"Accept-Encoding": "gzip, br"})
+	if w.Body.String() != "plain" || w.Header().Get("Vary") != "" {
+		t.Fatalf("files without variants are served as is, got %v", w.Header())
+	}
+}
@@ -0,0 +1,154 @@
+// template hot reload for debug mode, templates are re-parsed when their files change
+package engine
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// SetDebug turns the development mode on or off, call it before loading templates.
+// In debug mode templates are reloaded when their files change and template
+// parse errors are shown in the browser instead of panicking at startup.
+func (engine *Engine) SetDebug(debug bool) {
+	engine.debug = debug
+}
+
+// templateReloader is the HTMLRender of debug mode, it polls the signature of the
+// template files on render and swaps in a freshly parsed set when it changed,
+// renders in flight keep the set they started with
+type templateReloader struct {
+	parse     func() (htmlExecutor, error)
+	signature func() (string, error)
+	// mu is held by the request checking the files, the others don't wait for it
+	mu      sync.Mutex
+	current string
+	set     atomic.Pointer[templateSet]
+}
+
+var _ HTMLRender = (*templateReloader)(nil)
+
+// templateSet is a parse result, err is set if the templates don't parse
+type templateSet struct {
+	tmpl htmlExecutor
+	err  error
+}
+
+// templateParseError is returned by the reloader for templates that don't
+// parse, c.HTML shows it in the browser
+type templateParseError struct {
+	err error
+}
+
+func (e *templateParseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *templateParseError) Unwrap() error {
+	return e.err
+}
+
+// newTemplateReloader calls parse now and whenever signature changes,
+// signature lists the template files with their size and modtime
+func newTemplateReloader(parse func() (htmlExecutor, error), signature func() (string, error)) *templateReloader {
+	r := &templateReloader{parse: parse, signature: signature}
+	r.reload()
+	return r
+}
+
+// Render implements HTMLRender with the current set, reloaded first if a file changed
+func (r *templateReloader) Render(w io.Writer, name string, data interface{}) error {
+	if r.mu.TryLock() {
+		r.reload()
+		r.mu.Unlock()
+	}
+	set := r.set.Load()
+	if set.err != nil {
+		return &templateParseError{set.err}
+	}
+	return set.tmpl.ExecuteTemplate(w, name, data)
+}
+
+// reload parses the templates again if the files changed since the last parse,
+// the caller holds mu (or owns r)
+func (r *templateReloader) reload() {
+	signature, err := r.signature()
+	if err == nil && signature == r.current && r.set.Load() != nil {
+		return
+	}
+	set := &templateSet{err: err}
+	if err == nil {
+		set.tmpl, set.err = r.parse()
+	}
+	if r.set.Load() != nil {
+		log.Printf("[debug] templates changed, reloaded")
+	}
+	if set.err != nil {
+		log.Printf("[debug] templates: %v", set.err)
+	}
+	r.current = signature
+	r.set.Store(set)
+}
+
+// globSignature lists the matching files with their size and modtime,
+// a new, removed or edited template changes it
+func globSignature(patterns ...string) (string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, matches...)
+	}
+	return fileSignature(files...)
+}
+
+func fileSignature(files ...string) (string, error) {
+	var b strings.Builder
+	for _, file := range files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s|%d|%d\n", file, stat.Size(), stat.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+// fsGlobSignature is globSignature for an fs.FS, the files of an embed.FS never change
+func fsGlobSignature(fsys fs.FS, patterns ...string) (string, error) {
+	var b strings.Builder
+	for _, pattern := range patterns {
+		files, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return "", err
+		}
+		for _, file := range files {
+			stat, err := fs.Stat(fsys, file)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "%s|%d|%d\n", file, stat.Size(), stat.ModTime().UnixNano())
+		}
+	}
+	return b.String(), nil
+}
+
+// templateError shows a template parse error in the browser, debug mode only
+func (c *Context) templateError(err error) {
+	c.Error(err)
+	c.Abort()
+	c.SetHeader("Content-Type", "text/html; charset=utf-8")
+	c.SetStatus(http.StatusInternalServerError)
+	c.Writer.WriteString("<!DOCTYPE html><html><head><title>Template error</title></head><body>" +
+		"<h1>Template error</h1><pre>" + html.EscapeString(err.Error()) + "</pre></body></html>")
+}
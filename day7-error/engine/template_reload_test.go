@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newReloadEngine(t *testing.T, dir string) *Engine {
+	r := New()
+	r.SetDebug(true)
+	r.LoadHTMLGlob(dir + "/*.tmpl")
+	r.Get("/", func(c *Context) {
+		c.HTML(http.StatusOK, "index.tmpl", "tom")
+	})
+	return r
+}
+
+func TestTemplateReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "index.tmpl", `<p>hello {{.}}</p>`)
+	r := newReloadEngine(t, dir)
+
+	if w := serveWith(r, "GET", "/", nil); w.Body.String() != "<p>hello tom</p>" {
+		t.Fatalf("unexpected page %q", w.Body.String())
+	}
+	writeTemplate(t, dir, "index.tmpl", `<p>welcome back {{.}}</p>`)
+	if w := serveWith(r, "GET", "/", nil); w.Body.String() != "<p>welcome back tom</p>" {
+		t.Fatalf("edited template should be reloaded, got %q", w.Body.String())
+	}
+
+	// funcs set after LoadHTMLGlob are used by the next reload
+	r.SetFuncMap(template.FuncMap{"upper": strings.ToUpper})
+	writeTemplate(t, dir, "index.tmpl", `{{template "name" .}}`)
+	writeTemplate(t, dir, "name.tmpl", `{{define "name"}}<b>{{upper .}}</b>{{end}}`)
+	if w := serveWith(r, "GET", "/", nil); w.Body.String() != "<b>TOM</b>" {
+		t.Fatalf("new template files should be picked up, got %q", w.Body.String())
+	}
+}
+
+func TestTemplateReloadParseError(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "index.tmpl", `<p>{{.</p>`)
+	// no panic in debug mode
+	r := newReloadEngine(t, dir)
+
+	w := serveWith(r, "GET", "/", nil)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "<h1>Template error</h1>") ||
+		!strings.Contains(w.Body.String(), "index.tmpl") || strings.Contains(w.Body.String(), "<p>{{") {
+		t.Fatalf("parse error should be shown escaped, got %d %q", w.Code, w.Body.String())
+	}
+	writeTemplate(t, dir, "index.tmpl", `<p>fixed {{.}}</p>`)
+	if w = serveWith(r, "GET", "/", nil); w.Code != http.StatusOK || w.Body.String() != "<p>fixed tom</p>" {
+		t.Fatalf("fixed template should be served, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestTemplateReloadConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "index.tmpl", `<p>v0 {{.}}</p>`)
+	r := newReloadEngine(t, dir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if w := serveWith(r, "GET", "/", nil); w.Code != http.StatusOK {
+					t.Errorf("unexpected status %d %q", w.Code, w.Body.String())
+					return
+				}
+			}
+		}()
+	}
+	// editors save through a rename too, a half written file is a real parse error
+	for i := 1; i < 5; i++ {
+		if err := writeFileAtomic(filepath.Join(dir, "index.tmpl"), []byte(strings.Repeat(" ", i)+`<p>v{{.}}</p>`), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestLoadHTMLGlobPanicsOutsideDebug(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "index.tmpl", `<p>{{.</p>`)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("a parse error should panic at startup outside debug mode")
+		}
+	}()
+	New().LoadHTMLGlob(dir + "/*.tmpl")
+}
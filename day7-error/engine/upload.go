@@ -0,0 +1,261 @@
+// multipart uploads: buffered helpers on top of net/http and a streaming API
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMultipartMemory is the part of a multipart body kept in memory, the rest
+// goes to temporary files, same default as net/http
+const defaultMultipartMemory = 32 << 20
+
+// maxFieldSize bounds a non-file value read by StreamUpload
+const maxFieldSize = 1 << 20
+
+// sniffLen is how many bytes http.DetectContentType looks at
+const sniffLen = 512
+
+var (
+	ErrFileTooLarge       = errors.New("upload: file exceeds the size limit")
+	ErrUploadTooLarge     = errors.New("upload: request body exceeds the size limit")
+	ErrFileTypeNotAllowed = errors.New("upload: file type not allowed")
+	ErrFieldTooLarge      = errors.New("upload: form value exceeds the size limit")
+)
+
+// SetMaxMultipartMemory sets how many bytes of a multipart body are held in
+// memory by FormFile, MultipartForm and FormValue
+func (engine *Engine) SetMaxMultipartMemory(size int64) {
+	engine.maxMultipartMemory = size
+}
+
+// parseMultipartForm parses the body once, errors other than "not multipart"
+// are recorded on the context and returned again by later calls, the body is
+// consumed by then
+func (c *Context) parseMultipartForm() error {
+	if c.formParsed {
+		return c.formErr
+	}
+	c.formParsed = true
+	if c.Req.Form != nil && (c.Req.MultipartForm != nil || !isMultipart(c.Req)) {
+		return nil
+	}
+	err := c.Req.ParseMultipartForm(c.engine.maxMultipartMemory)
+	if err == http.ErrNotMultipart {
+		return nil
+	}
+	if err != nil {
+		c.formErr = err
+		c.Error(err)
+	}
+	return err
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(mediaType, "multipart/")
+}
+
+// MultipartForm returns the parsed multipart form, files included
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if err := c.parseMultipartForm(); err != nil {
+		return nil, err
+	}
+	if c.Req.MultipartForm == nil {
+		return nil, http.ErrNotMultipart
+	}
+	return c.Req.MultipartForm, nil
+}
+
+// FormFile returns the first file uploaded under name
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	files := form.File[name]
+	if len(files) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	return files[0], nil
+}
+
+// SaveUploadedFile copies an uploaded file to dst, the directory is created if needed.
+// dst is used as is: never build it from file.Filename without cleaning it.
+func (c *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// UploadOptions are the limits enforced by StreamUpload, zero means unlimited
+type UploadOptions struct {
+	// MaxFileSize is the limit of every single file
+	MaxFileSize int64
+	// MaxTotalSize is the limit of the whole request body
+	MaxTotalSize int64
+	// AllowedTypes are the MIME types accepted, checked against the sniffed
+	// content rather than the client supplied Content-Type, e.g. "image/png"
+	AllowedTypes []string
+}
+
+// UploadedFile describes a file written to disk by StreamUpload
+type UploadedFile struct {
+	Field       string // form field name
+	Filename    string // base name sent by the client, for display only
+	Path        string // where the file was saved
+	Size        int64
+	ContentType string // sniffed MIME type
+}
+
+// StreamedForm is the result of StreamUpload
+type StreamedForm struct {
+	Value map[string][]string
+	Files []*UploadedFile
+}
+
+// StreamUpload reads a multipart body part by part and writes every file under
+// dir with a random name, nothing is buffered whole in memory. On error the files
+// already written are removed and one of the Err* upload errors is returned when
+// a limit was hit.
+//
+//	form, err := c.StreamUpload("./uploads", engine.UploadOptions{
+//	    MaxFileSize:  10 << 20,
+//	    AllowedTypes: []string{"image/png", "image/jpeg"},
+//	})
+func (c *Context) StreamUpload(dir string, opts UploadOptions) (form *StreamedForm, err error) {
+	if opts.MaxTotalSize > 0 {
+		c.Req.Body = http.MaxBytesReader(c.Writer, c.Req.Body, opts.MaxTotalSize)
+	}
+	mr, err := c.Req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	form = &StreamedForm{Value: make(map[string][]string)}
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, file := range form.Files {
+			os.Remove(file.Path)
+		}
+		form = nil
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			err = ErrUploadTooLarge
+		}
+	}()
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			return form, err
+		}
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldSize+1))
+			if err != nil {
+				return form, err
+			}
+			if len(value) > maxFieldSize {
+				return form, ErrFieldTooLarge
+			}
+			form.Value[part.FormName()] = append(form.Value[part.FormName()], string(value))
+			continue
+		}
+		file, err := saveStreamedPart(part, dir, opts)
+		if file != nil {
+			form.Files = append(form.Files, file)
+		}
+		if err != nil {
+			return form, err
+		}
+	}
+}
+
+// saveStreamedPart sniffs, checks and copies one file part, the returned file
+// is non nil as soon as something was created on disk
+func saveStreamedPart(part *multipart.Part, dir string, opts UploadOptions) (*UploadedFile, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if !typeAllowed(contentType, opts.AllowedTypes) {
+		return nil, ErrFileTypeNotAllowed
+	}
+
+	// the client name is only trusted for its extension
+	filename := filepath.Base(filepath.Clean("/" + part.FileName()))
+	out, err := os.CreateTemp(dir, "upload-*"+filepath.Ext(filename))
+	if err != nil {
+		return nil, err
+	}
+	file := &UploadedFile{
+		Field:       part.FormName(),
+		Filename:    filename,
+		Path:        out.Name(),
+		ContentType: contentType,
+	}
+
+	var src io.Reader = io.MultiReader(bytes.NewReader(head), part)
+	if opts.MaxFileSize > 0 {
+		// one extra byte tells "exactly at the limit" from "over the limit"
+		src = io.LimitReader(src, opts.MaxFileSize+1)
+	}
+	file.Size, err = io.Copy(out, src)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return file, err
+	}
+	if opts.MaxFileSize > 0 && file.Size > opts.MaxFileSize {
+		return file, ErrFileTooLarge
+	}
+	return file, nil
+}
+
+// typeAllowed compares media types without parameters, e.g. "text/plain; charset=utf-8"
+func typeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, t := range allowed {
+		if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pngHeader is enough for http.DetectContentType to report image/png
+var pngHeader = []byte("\x89PNG\r\n\x1a\n0000")
+
+func newUploadRequest(t *testing.T, fields map[string]string, files map[string][]byte) *http.Request {
+	t.Helper()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(content)
+	}
+	mw.Close()
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestFormFileAndSave(t *testing.T) {
+	c, _ := newTestContext("POST", "/upload")
+	c.Req = newUploadRequest(t, map[string]string{"title": "hello"}, map[string][]byte{"a.txt": []byte("content")})
+	if c.FormValue("title") != "hello" {
+		t.Fatal("FormValue should read multipart values")
+	}
+	fh, err := c.FormFile("file")
+	if err != nil || fh.Filename != "a.txt" {
+		t.Fatalf("unexpected form file %v %v", fh, err)
+	}
+	dst := filepath.Join(t.TempDir(), "sub", "a.txt")
+	if err := c.SaveUploadedFile(fh, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "content" {
+		t.Fatal("saved file content mismatch")
+	}
+	if _, err := c.FormFile("missing"); err != http.ErrMissingFile {
+		t.Fatal("missing file should return http.ErrMissingFile")
+	}
+}
+
+func TestFormValueRecordsParseError(t *testing.T) {
+	c, _ := newTestContext("POST", "/upload")
+	c.Req = httptest.NewRequest("POST", "/upload", bytes.NewBufferString("garbage"))
+	c.Req.Header.Set("Content-Type", "multipart/form-data; boundary=xxx")
+	if c.FormValue("title") != "" {
+		t.Fatal("malformed multipart body has no values")
+	}
+	c.PostForm("title")
+	if _, err := c.MultipartForm(); err == nil {
+		t.Fatal("later accessors should return the parse error")
+	}
+	if len(c.Errors) != 1 {
+		t.Fatalf("parse error should be recorded once, got %v", c.Errors)
+	}
+}
+
+func TestStreamUpload(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := newTestContext("POST", "/upload")
+	c.Req = newUploadRequest(t, map[string]string{"title": "photo"}, map[string][]byte{"../../evil.png": pngHeader})
+	form, err := c.StreamUpload(dir, UploadOptions{AllowedTypes: []string{"image/png"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Value["title"][0] != "photo" || len(form.Files) != 1 {
+		t.Fatalf("unexpected form %v", form)
+	}
+	file := form.Files[0]
+	if file.Filename != "evil.png" || file.ContentType != "image/png" || file.Size != int64(len(pngHeader)) {
+		t.Fatalf("unexpected uploaded file %+v", file)
+	}
+	if filepath.Dir(file.Path) != dir {
+		t.Fatal("file must be saved inside dir")
+	}
+}
+
+func TestStreamUploadLimits(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := newTestContext("POST", "/upload")
+
+	// sniffing ignores the client name and Content-Type
+	c.Req = newUploadRequest(t, nil, map[string][]byte{"fake.png": []byte("plain text")})
+	if _, err := c.StreamUpload(dir, UploadOptions{AllowedTypes: []string{"image/png"}}); err != ErrFileTypeNotAllowed {
+		t.Fatalf("expected ErrFileTypeNotAllowed, got %v", err)
+	}
+
+	c.Req = newUploadRequest(t, nil, map[string][]byte{"big.txt": bytes.Repeat([]byte("a"), 100)})
+	if _, err := c.StreamUpload(dir, UploadOptions{MaxFileSize: 99}); err != ErrFileTooLarge {
+		t.Fatalf("expected ErrFileTooLarge, got %v", err)
+	}
+
+	c.Req = newUploadRequest(t, nil, map[string][]byte{"big.txt": bytes.Repeat([]byte("a"), 1000)})
+	if _, err := c.StreamUpload(dir, UploadOptions{MaxTotalSize: 500}); err != ErrUploadTooLarge {
+		t.Fatalf("expected ErrUploadTooLarge, got %v", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("rejected uploads should be removed, found %d files", len(entries))
+	}
+}
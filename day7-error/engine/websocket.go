@@ -0,0 +1,540 @@
+// RFC 6455 websocket support built on top of net/http hijacking
+package engine
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// magic value from RFC 6455 section 1.3, appended to Sec-WebSocket-Key
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// message types, they are the frame opcodes of RFC 6455 section 5.2
+const (
+	continuationFrame = 0
+	TextMessage       = 1
+	BinaryMessage     = 2
+	CloseMessage      = 8
+	PingMessage       = 9
+	PongMessage       = 10
+)
+
+// close codes defined in RFC 6455 section 7.4.1
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	// control frames payload must not exceed 125 bytes
+	maxControlPayload = 125
+	// defaultReadLimit is the per-message size limit unless SetReadLimit is called
+	defaultReadLimit = 1 << 20
+)
+
+var (
+	ErrBadHandshake   = errors.New("websocket: bad handshake")
+	ErrReadLimit      = errors.New("websocket: read limit exceeded")
+	ErrCloseSent      = errors.New("websocket: close sent")
+	errInvalidUTF8    = errors.New("websocket: invalid utf8 in text message")
+	errInvalidControl = errors.New("websocket: invalid control frame")
+)
+
+// CloseError is returned by ReadMessage once the peer sent a close frame
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+// Upgrader holds the options used to upgrade a request to a websocket connection.
+// The zero value is usable: it checks that Origin matches Host and limits messages
+// to defaultReadLimit bytes.
+type Upgrader struct {
+	// ReadLimit is the maximum size in bytes of a message read from the peer
+	ReadLimit int64
+	// CheckOrigin returns true if the request Origin is acceptable,
+	// nil means the Origin host must equal the request Host
+	CheckOrigin func(r *http.Request) bool
+	// HandshakeTimeout bounds the time spent writing the 101 response
+	HandshakeTimeout time.Duration
+}
+
+var defaultUpgrader = &Upgrader{}
+
+// Upgrade upgrades the HTTP connection of the context to the websocket protocol with
+// default options. It is meant to be called from a route handler, so every group
+// middleware (auth, logger...) has already run when the handshake happens.
+//
+//	v1.Get("/ws", func(c *engine.Context) {
+//	    conn, err := c.Upgrade()
+//	    if err != nil {
+//	        return
+//	    }
+//	    defer conn.Close()
+//	    for {
+//	        mt, msg, err := conn.ReadMessage()
+//	        if err != nil {
+//	            return
+//	        }
+//	        conn.WriteMessage(mt, msg)
+//	    }
+//	})
+func (c *Context) Upgrade() (*Conn, error) {
+	return defaultUpgrader.Upgrade(c)
+}
+
+// Upgrade validates the opening handshake, on failure an HTTP error is replied and
+// the handler chain is stopped. On success the connection is hijacked from net/http,
+// so nothing must be written through c.Writer afterwards.
+func (u *Upgrader) Upgrade(c *Context) (*Conn, error) {
+	r := c.Req
+	if r.Method != http.MethodGet {
+		return nil, u.fail(c, http.StatusMethodNotAllowed, "websocket: method is not GET")
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") {
+		return nil, u.fail(c, http.StatusBadRequest, "websocket: missing 'upgrade' token in Connection header")
+	}
+	if !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return nil, u.fail(c, http.StatusBadRequest, "websocket: missing 'websocket' token in Upgrade header")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		c.SetHeader("Sec-WebSocket-Version", "13")
+		return nil, u.fail(c, http.StatusUpgradeRequired, "websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-Websocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, u.fail(c, http.StatusBadRequest, "websocket: invalid Sec-WebSocket-Key")
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return nil, u.fail(c, http.StatusForbidden, "websocket: origin not allowed")
+	}
+
+	netConn, brw, err := c.Writer.Hijack()
+	if err != nil {
+		// e.g. HTTP/2, nothing was sent yet
+		c.Error(err)
+		return nil, u.fail(c, http.StatusInternalServerError, "websocket: connection can't be hijacked")
+	}
+	// recorded only, the 101 below is written by hand on the hijacked connection
+	c.SetStatus(http.StatusSwitchingProtocols)
+	// the client must wait for 101 before sending frames, anything already buffered
+	// is a protocol violation
+	if brw.Reader.Buffered() > 0 {
+		netConn.Close()
+		return nil, ErrBadHandshake
+	}
+
+	var resp strings.Builder
+	resp.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	resp.WriteString("Upgrade: websocket\r\n")
+	resp.WriteString("Connection: Upgrade\r\n")
+	resp.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")
+	if u.HandshakeTimeout > 0 {
+		netConn.SetWriteDeadline(time.Now().Add(u.HandshakeTimeout))
+	}
+	if _, err := netConn.Write([]byte(resp.String())); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	// clear deadlines set by http.Server, the websocket has its own lifetime
+	netConn.SetDeadline(time.Time{})
+
+	conn := newConn(netConn, brw.Reader, true)
+	if u.ReadLimit > 0 {
+		conn.SetReadLimit(u.ReadLimit)
+	}
+	return conn, nil
+}
+
+// fail replies the handshake error and stops the chain
+func (u *Upgrader) fail(c *Context, code int, reason string) error {
+	c.Fail(code, reason)
+	return ErrBadHandshake
+}
+
+// acceptKey computes Sec-WebSocket-Accept from Sec-WebSocket-Key
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContainsToken checks comma separated header values case insensitively,
+// e.g. Connection: keep-alive, Upgrade
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, v := range header.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin accepts requests without Origin (non browser clients) or whose Origin
+// host is the request Host, this prevents cross-site websocket hijacking
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// Conn is a websocket connection. ReadMessage must be called from one goroutine
+// only, writes are serialized internally so that the reader can answer pings while
+// another goroutine writes messages.
+type Conn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	isServer bool // server side reads masked frames and writes unmasked ones
+
+	readLimit   int64
+	pongHandler func(data string)
+
+	writeMu       sync.Mutex
+	closeSent     bool
+	writeDeadline time.Time // applied to data frames, control frames bring their own
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	return &Conn{
+		conn:      conn,
+		br:        br,
+		isServer:  isServer,
+		readLimit: defaultReadLimit,
+	}
+}
+
+// SetReadLimit sets the maximum size of a message, a message over the limit
+// closes the connection with CloseMessageTooBig
+func (ws *Conn) SetReadLimit(limit int64) {
+	ws.readLimit = limit
+}
+
+// SetPongHandler registers a callback run by ReadMessage when a pong arrives
+func (ws *Conn) SetPongHandler(h func(data string)) {
+	ws.pongHandler = h
+}
+
+func (ws *Conn) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of the following data message writes
+func (ws *Conn) SetWriteDeadline(t time.Time) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	ws.writeDeadline = t
+	return nil
+}
+
+func (ws *Conn) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// frame is one decoded frame header and its unmasked payload
+type frame struct {
+	fin     bool
+	opcode  int
+	payload []byte
+}
+
+// readFrame reads a single frame, remaining is the number of bytes the message
+// may still grow by before the read limit is reached
+func (ws *Conn) readFrame(remaining int64) (*frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.br, head[:]); err != nil {
+		return nil, err
+	}
+	f := &frame{
+		fin:    head[0]&0x80 != 0,
+		opcode: int(head[0] & 0x0f),
+	}
+	// no extension is negotiated, so RSV1-3 must be 0
+	if head[0]&0x70 != 0 {
+		return nil, ws.protocolError("reserved bits set")
+	}
+	masked := head[1]&0x80 != 0
+	if masked != ws.isServer {
+		return nil, ws.protocolError("bad masking")
+	}
+
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return nil, err
+		}
+		// most significant bit must be 0
+		if ext[0]&0x80 != 0 {
+			return nil, ws.protocolError("invalid payload length")
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	switch f.opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+		if length > remaining {
+			ws.WriteControl(CloseMessage, formatClose(CloseMessageTooBig, ""), time.Now().Add(time.Second))
+			return nil, ErrReadLimit
+		}
+	case CloseMessage, PingMessage, PongMessage:
+		if !f.fin || length > maxControlPayload {
+			return nil, ws.protocolError(errInvalidControl.Error())
+		}
+	default:
+		return nil, ws.protocolError(fmt.Sprintf("unknown opcode %d", f.opcode))
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+			return nil, err
+		}
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.br, f.payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		maskBytes(mask, f.payload)
+	}
+	return f, nil
+}
+
+// ReadMessage returns the next complete data message, fragmented messages are
+// reassembled. Ping frames are answered with pongs and a close frame is echoed
+// before *CloseError is returned.
+func (ws *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	var message []byte
+	messageType = -1
+	for {
+		f, err := ws.readFrame(ws.readLimit - int64(len(message)))
+		if err != nil {
+			return -1, nil, err
+		}
+		switch f.opcode {
+		case PingMessage:
+			if err := ws.WriteControl(PongMessage, f.payload, time.Now().Add(time.Second)); err != nil && err != ErrCloseSent {
+				return -1, nil, err
+			}
+			continue
+		case PongMessage:
+			if ws.pongHandler != nil {
+				ws.pongHandler(string(f.payload))
+			}
+			continue
+		case CloseMessage:
+			return -1, nil, ws.handleClose(f.payload)
+		case continuationFrame:
+			if messageType == -1 {
+				return -1, nil, ws.protocolError("continuation frame without a started message")
+			}
+		default:
+			if messageType != -1 {
+				return -1, nil, ws.protocolError("new message before the previous one finished")
+			}
+			messageType = f.opcode
+		}
+		message = append(message, f.payload...)
+		if !f.fin {
+			continue
+		}
+		if messageType == TextMessage && !utf8.Valid(message) {
+			ws.WriteControl(CloseMessage, formatClose(CloseInvalidFramePayloadData, ""), time.Now().Add(time.Second))
+			return -1, nil, errInvalidUTF8
+		}
+		return messageType, message, nil
+	}
+}
+
+// handleClose validates the close payload, echoes it and returns the close error
+func (ws *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return ws.protocolError("invalid close payload")
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return ws.protocolError(fmt.Sprintf("invalid close code %d", closeErr.Code))
+		}
+		if !utf8.Valid(payload[2:]) {
+			return ws.protocolError("invalid utf8 in close reason")
+		}
+	}
+	echo := []byte{}
+	if closeErr.Code != CloseNoStatusReceived {
+		echo = formatClose(closeErr.Code, "")
+	}
+	ws.WriteControl(CloseMessage, echo, time.Now().Add(time.Second))
+	return closeErr
+}
+
+// protocolError closes the connection with CloseProtocolError
+func (ws *Conn) protocolError(reason string) error {
+	ws.WriteControl(CloseMessage, formatClose(CloseProtocolError, ""), time.Now().Add(time.Second))
+	return errors.New("websocket: protocol error: " + reason)
+}
+
+// WriteMessage sends data as one unfragmented message, messageType is TextMessage
+// or BinaryMessage. Control messages are delegated to WriteControl.
+func (ws *Conn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		return ws.WriteControl(messageType, data, time.Time{})
+	default:
+		return fmt.Errorf("websocket: unknown message type %d", messageType)
+	}
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	ws.conn.SetWriteDeadline(ws.writeDeadline)
+	return ws.writeFrame(messageType, data)
+}
+
+// WriteControl sends a ping, pong or close frame, a zero deadline means no deadline
+func (ws *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if messageType != CloseMessage && messageType != PingMessage && messageType != PongMessage {
+		return errInvalidControl
+	}
+	if len(data) > maxControlPayload {
+		return errInvalidControl
+	}
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	if messageType == CloseMessage {
+		ws.closeSent = true
+	}
+	ws.conn.SetWriteDeadline(deadline)
+	return ws.writeFrame(messageType, data)
+}
+
+// writeFrame must be called with writeMu held
+func (ws *Conn) writeFrame(opcode int, data []byte) error {
+	header := make([]byte, 0, 14)
+	header = append(header, 0x80|byte(opcode))
+	var maskBit byte
+	if !ws.isServer {
+		maskBit = 0x80
+	}
+	length := len(data)
+	switch {
+	case length <= 125:
+		header = append(header, maskBit|byte(length))
+	case length <= 0xffff:
+		header = append(header, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	if !ws.isServer {
+		// clients must mask every frame with a fresh random key
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		header = append(header, mask[:]...)
+		masked := make([]byte, length)
+		copy(masked, data)
+		maskBytes(mask, masked)
+		data = masked
+	}
+	_, err := ws.conn.Write(append(header, data...))
+	return err
+}
+
+// Close sends a normal close frame (if not sent yet) and closes the connection
+func (ws *Conn) Close() error {
+	return ws.CloseWithCode(CloseNormalClosure, "")
+}
+
+// CloseWithCode sends a close frame with the given code and reason, then closes
+// the underlying connection without waiting for the peer echo
+func (ws *Conn) CloseWithCode(code int, text string) error {
+	ws.WriteControl(CloseMessage, formatClose(code, text), time.Now().Add(time.Second))
+	return ws.conn.Close()
+}
+
+// formatClose builds a close frame payload, the reason is truncated to fit 125 bytes
+func formatClose(code int, text string) []byte {
+	if len(text) > maxControlPayload-2 {
+		text = text[:maxControlPayload-2]
+	}
+	buf := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(buf, uint16(code))
+	copy(buf[2:], text)
+	return buf
+}
+
+// validCloseCode reports whether code may be sent on the wire, see RFC 6455 7.4
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// maskBytes xors b with the masking key in place
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// dialWebSocket performs the client side of the opening handshake against server
+func dialWebSocket(t *testing.T, server *httptest.Server, path string, header http.Header) (*Conn, *http.Response) {
+	t.Helper()
+	netConn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", server.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := req.Write(netConn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		netConn.Close()
+		return nil, resp
+	}
+	return newConn(netConn, br, false), resp
+}
+
+// writeRawFrame lets tests send frames a well behaved Conn never produces
+func writeRawFrame(t *testing.T, ws *Conn, fin bool, opcode int, payload []byte) {
+	t.Helper()
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0, 0x80 | byte(len(payload)), 1, 2, 3, 4}
+	masked := make([]byte, len(payload))
+	copy(masked, payload)
+	maskBytes([4]byte{1, 2, 3, 4}, masked)
+	if _, err := ws.conn.Write(append(frame, masked...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newEchoServer() *httptest.Server {
+	r := New()
+	v1 := r.Group("/v1")
+	v1.AppendMid(func(c *Context) {
+		if c.Query("token") != "secret" {
+			c.Fail(http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		c.Next()
+	})
+	v1.Get("/ws", func(c *Context) {
+		conn, err := c.Upgrade()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetReadLimit(64)
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(mt, msg)
+		}
+	})
+	return httptest.NewServer(r)
+}
+
+func TestWebSocketAcceptKey(t *testing.T) {
+	// example from RFC 6455 section 1.3
+	if acceptKey("dGhlIHNhbXBsZSBub25jZQ==") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal("accept key doesn't match RFC 6455 example")
+	}
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+
+	ws, resp := dialWebSocket(t, server, "/v1/ws?token=secret", nil)
+	if ws == nil {
+		t.Fatalf("handshake failed with status %d", resp.StatusCode)
+	}
+	defer ws.Close()
+	if resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal("wrong Sec-WebSocket-Accept")
+	}
+
+	if err := ws.WriteMessage(TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	mt, msg, err := ws.ReadMessage()
+	if err != nil || mt != TextMessage || string(msg) != "hello" {
+		t.Fatalf("unexpected echo %d %q %v", mt, msg, err)
+	}
+
+	// fragmented message with a ping in between
+	writeRawFrame(t, ws, false, TextMessage, []byte("frag"))
+	writeRawFrame(t, ws, true, PingMessage, []byte("p"))
+	writeRawFrame(t, ws, true, continuationFrame, []byte("mented"))
+	pong := ""
+	ws.SetPongHandler(func(data string) { pong = data })
+	mt, msg, err = ws.ReadMessage()
+	if err != nil || mt != TextMessage || string(msg) != "fragmented" {
+		t.Fatalf("unexpected echo %d %q %v", mt, msg, err)
+	}
+	if pong != "p" {
+		t.Fatal("ping should be answered with pong")
+	}
+}
+
+func TestWebSocketGroupMiddleware(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+
+	ws, resp := dialWebSocket(t, server, "/v1/ws", nil)
+	if ws != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal("group middleware should reject the upgrade")
+	}
+}
+
+func TestWebSocketBadHandshake(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+
+	ws, resp := dialWebSocket(t, server, "/v1/ws?token=secret", http.Header{"Sec-Websocket-Version": {"8"}})
+	if ws != nil || resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatal("unsupported version should be rejected with 426")
+	}
+	ws, resp = dialWebSocket(t, server, "/v1/ws?token=secret", http.Header{"Origin": {"http://evil.example"}})
+	if ws != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatal("cross origin upgrade should be rejected with 403")
+	}
+}
+
+func TestWebSocketCloseCodes(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+
+	// message over the read limit
+	ws, _ := dialWebSocket(t, server, "/v1/ws?token=secret", nil)
+	ws.WriteMessage(BinaryMessage, make([]byte, 100))
+	_, _, err := ws.ReadMessage()
+	if ce, ok := err.(*CloseError); !ok || ce.Code != CloseMessageTooBig {
+		t.Fatalf("expected close 1009, got %v", err)
+	}
+	ws.Close()
+
+	// unmasked client frame is a protocol error
+	ws, _ = dialWebSocket(t, server, "/v1/ws?token=secret", nil)
+	ws.conn.Write([]byte{0x81, 0x01, 'x'})
+	_, _, err = ws.ReadMessage()
+	if ce, ok := err.(*CloseError); !ok || ce.Code != CloseProtocolError {
+		t.Fatalf("expected close 1002, got %v", err)
+	}
+	ws.Close()
+
+	// normal close is echoed
+	ws, _ = dialWebSocket(t, server, "/v1/ws?token=secret", nil)
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, CloseGoingAway)
+	writeRawFrame(t, ws, true, CloseMessage, payload)
+	_, _, err = ws.ReadMessage()
+	if ce, ok := err.(*CloseError); !ok || ce.Code != CloseGoingAway {
+		t.Fatalf("expected close 1001 echo, got %v", err)
+	}
+	ws.Close()
+}
+
+func TestWebSocketHijackFailure(t *testing.T) {
+	r := New()
+	var upgradeErr error
+	r.Get("/ws", func(c *Context) {
+		_, upgradeErr = c.Upgrade()
+	})
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	// a recorder can't be hijacked, like an HTTP/2 response
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if upgradeErr == nil {
+		t.Fatal("upgrade should fail when the connection can't be hijacked")
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("failed hijack should be a 500, got %d", w.Code)
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"embed"
+	"io/fs"
+	"log"
 	"net/http"
 
 	"engine"
@@ -27,6 +30,15 @@ import (
 
 // 2024/06/07 10:03:59 [500] /panic in 428.3µs
 
+// the assets and templates are built into the binary, it no longer needs
+// ./static and ./templates next to it
+//
+//go:embed static
+var staticFS embed.FS
+
+//go:embed templates
+var templatesFS embed.FS
+
 func main() {
 	r := engine.Default()
 	r.Get("/", func(c *engine.Context) {
@@ -37,6 +49,19 @@ func main() {
 		names := []string{"test"}
 		c.Plain(http.StatusOK, names[100])
 	})
+	// localhost:8080/assets/css/geektutu.css, or its fingerprinted name used by the asset template func
+	assets, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := r.StaticAssets("/assets", http.FS(assets), engine.AssetOptions{}); err != nil {
+		log.Fatal(err)
+	}
+	// css.tmpl links the cache-busted URL of geektutu.css
+	r.LoadHTMLFS(templatesFS, "templates/css.tmpl")
+	r.Get("/css", func(c *engine.Context) {
+		c.HTML(http.StatusOK, "css.tmpl", nil)
+	})
 
 	r.Run(":8080")
 }